@@ -0,0 +1,541 @@
+package jmux
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The sources values are bound from, in the order they are applied by
+// Context.Bind (after the JSON body).
+const (
+	sourceForm = iota
+	sourceQuery
+	sourceHeader
+	sourcePath
+	numSources
+)
+
+// sourceTags are the struct tags for each source.
+var sourceTags = [numSources]string{"form", "query", "header", "path"}
+
+// FieldError is an error binding a single value to a struct field.
+type FieldError struct {
+	// Field is the Go path of the struct field (e.g., "Page" or
+	// "Filter.Page"), or empty if the error isn't for a specific field.
+	Field string
+	// Source is where the value came from ("path", "query", "header",
+	// "form", or "json").
+	Source string
+	// Key is the name of the value in its source (e.g., the query key).
+	Key string
+	// Value is the value that failed to bind, if known.
+	Value string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the error as a string.
+func (e *FieldError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Source)
+	if e.Key != "" {
+		fmt.Fprintf(&b, " %q", e.Key)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, " (field %s)", e.Field)
+	}
+	if e.Value != "" {
+		fmt.Fprintf(&b, ": invalid value %q", e.Value)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// BindError is returned when values from a request can't be bound to a
+// struct. It holds an error for every value that failed to bind.
+type BindError struct {
+	Errors []*FieldError
+}
+
+// Error returns the error as a string.
+func (e *BindError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return "jmux: bind: " + strings.Join(msgs, "; ")
+}
+
+// err returns the error, or nil if there are no errors.
+func (e *BindError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Bind fills the struct pointed to by dst with values from the request,
+// using the following field tags:
+//
+//	path:"id"         the path parameter "id" (from Params)
+//	query:"page"      the query value "page"
+//	header:"X-Tenant" the request header "X-Tenant"
+//	form:"name"       the form value "name" from a URL-encoded or multipart body
+//	json:"name"       the field "name" of a JSON body (see encoding/json)
+//
+// The JSON body is only read for requests with a JSON content type, and form
+// values only for requests with a form content type. Sources are applied in
+// the order JSON body, form, query, headers, then path, so values from later
+// sources take precedence. Fields without a value in any source (and fields
+// tagged "-") are left unchanged, as are fields other than strings given
+// empty values, so defaults can be set before calling Bind. Fields of
+// embedded structs are bound as if they were fields of the outer struct.
+//
+// Values are converted to the field's type, which may be a string, bool,
+// integer, float, time.Duration, time.Time (in RFC 3339 format, or the layout
+// given by a "format" tag, e.g., format:"2006-01-02"), a type implementing
+// encoding.TextUnmarshaler, or a pointer to or slice of one of those. Slices
+// are filled with every value for the key (e.g., "?tag=a&tag=b").
+//
+// If any values fail to convert, all other values are still bound, and a
+// *BindError describing every failure is returned. Other errors (e.g., dst
+// not being a pointer to a struct, or a field of an unsupported type) are
+// returned as is.
+func (c *Context) Bind(dst any) error {
+	fields, err := bindFieldsOf(dst)
+	if err != nil {
+		return err
+	}
+	be := &BindError{}
+	if isJSONRequest(c.Request) {
+		if err := c.bindJSON(dst); err != nil {
+			jsonErr, ok := err.(*BindError)
+			if !ok {
+				return err
+			}
+			be.Errors = append(be.Errors, jsonErr.Errors...)
+		}
+	}
+	for source := 0; source < numSources; source++ {
+		if source == sourceForm && !isFormRequest(c.Request) {
+			continue
+		}
+		if err := c.bindSource(dst, fields, source, be); err != nil {
+			return err
+		}
+	}
+	return be.err()
+}
+
+// BindPath fills the struct pointed to by dst with values from the path
+// parameters, using "path" field tags. See Context.Bind.
+func (c *Context) BindPath(dst any) error {
+	return c.bindOnly(dst, sourcePath)
+}
+
+// BindQuery fills the struct pointed to by dst with values from the query,
+// using "query" field tags. See Context.Bind.
+func (c *Context) BindQuery(dst any) error {
+	return c.bindOnly(dst, sourceQuery)
+}
+
+// BindHeader fills the struct pointed to by dst with values from the request
+// headers, using "header" field tags. See Context.Bind.
+func (c *Context) BindHeader(dst any) error {
+	return c.bindOnly(dst, sourceHeader)
+}
+
+// BindForm fills the struct pointed to by dst with values from a URL-encoded
+// or multipart form body, using "form" field tags, regardless of the
+// request's content type. See Context.Bind.
+func (c *Context) BindForm(dst any) error {
+	return c.bindOnly(dst, sourceForm)
+}
+
+// BindJSON decodes the JSON body into dst, regardless of the request's
+// content type. Unlike ReadBodyJSON, an empty body isn't an error, and errors
+// in the body are returned as a *BindError.
+func (c *Context) BindJSON(dst any) error {
+	return c.bindJSON(dst)
+}
+
+// bindOnly binds the values from the single source to dst.
+func (c *Context) bindOnly(dst any, source int) error {
+	fields, err := bindFieldsOf(dst)
+	if err != nil {
+		return err
+	}
+	be := &BindError{}
+	if err := c.bindSource(dst, fields, source, be); err != nil {
+		return err
+	}
+	return be.err()
+}
+
+// bindSource binds the values from the source to the fields of dst, adding
+// conversion errors to be. Returns any other error.
+func (c *Context) bindSource(dst any, fields []bindField, source int, be *BindError) error {
+	var lookup func(key string) []string
+	switch source {
+	case sourcePath:
+		lookup = func(key string) []string {
+			if v, ok := c.Params[key]; ok {
+				return []string{v}
+			}
+			return nil
+		}
+	case sourceQuery:
+		query := c.Request.URL.Query()
+		lookup = func(key string) []string { return query[key] }
+	case sourceHeader:
+		lookup = c.Request.Header.Values
+	case sourceForm:
+		if err := parseForm(c.Request); err != nil {
+			be.Errors = append(be.Errors, &FieldError{Source: sourceTags[source], Err: err})
+			return nil
+		}
+		lookup = func(key string) []string { return c.Request.PostForm[key] }
+	}
+	v := reflect.ValueOf(dst).Elem()
+	for _, f := range fields {
+		key := f.keys[source]
+		if key == "" {
+			continue
+		}
+		values := lookup(key)
+		if len(values) == 0 {
+			continue
+		}
+		fv, err := fieldByIndex(v, f.index)
+		if err != nil {
+			return err
+		}
+		if value, err := setValue(fv, values, f.layout); err != nil {
+			be.Errors = append(be.Errors, &FieldError{
+				Field:  f.name,
+				Source: sourceTags[source],
+				Key:    key,
+				Value:  value,
+				Err:    err,
+			})
+		}
+	}
+	return nil
+}
+
+// bindJSON decodes the JSON body into dst.
+func (c *Context) bindJSON(dst any) error {
+	body := c.Request.Body
+	if body == nil || body == http.NoBody {
+		return nil
+	}
+	defer body.Close()
+	err := json.NewDecoder(body).Decode(dst)
+	if err == nil || err == io.EOF {
+		return nil
+	}
+	var (
+		typeErr    *json.UnmarshalTypeError
+		invalidErr *json.InvalidUnmarshalError
+	)
+	if errors.As(err, &invalidErr) {
+		return err
+	}
+	fe := &FieldError{Source: "json", Err: err}
+	if errors.As(err, &typeErr) {
+		fe.Key = typeErr.Field
+		fe.Err = fmt.Errorf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+	}
+	return &BindError{Errors: []*FieldError{fe}}
+}
+
+// bindField is a struct field that can be bound.
+type bindField struct {
+	// The index of the field for reflect.Value.FieldByIndex
+	index []int
+	// The Go path of the field
+	name string
+	// The key for each source, empty if the field isn't bound from it
+	keys [numSources]string
+	// The layout for time.Time values
+	layout string
+}
+
+// bindFieldsCache caches the bindable fields of struct types.
+var bindFieldsCache sync.Map
+
+// bindFieldsOf returns the bindable fields of the struct pointed to by dst.
+func bindFieldsOf(dst any) ([]bindField, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("jmux: bind: destination must be a non-nil pointer to a struct, got %T", dst)
+	}
+	t := v.Elem().Type()
+	if fields, ok := bindFieldsCache.Load(t); ok {
+		return fields.([]bindField), nil
+	}
+	fields, err := bindFields(t, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	bindFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+// bindFields returns the bindable fields of the struct type, with the given
+// index and name prefixes.
+func bindFields(t reflect.Type, index []int, prefix string) ([]bindField, error) {
+	var fields []bindField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		f := bindField{
+			index:  append(append([]int(nil), index...), i),
+			name:   prefix + sf.Name,
+			layout: sf.Tag.Get("format"),
+		}
+		tagged := false
+		for source, tag := range sourceTags {
+			if key := sf.Tag.Get(tag); key != "" && key != "-" {
+				f.keys[source], tagged = key, true
+			}
+		}
+		if !tagged {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && ft.Kind() == reflect.Struct {
+				embedded, err := bindFields(ft, f.index, f.name+".")
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, embedded...)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			return nil, fmt.Errorf("jmux: bind: field %s is unexported", f.name)
+		}
+		if !canBind(sf.Type) {
+			return nil, fmt.Errorf("jmux: bind: field %s has unsupported type %s", f.name, sf.Type)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// canBind returns whether values can be bound to the type.
+func canBind(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice && !isScalar(t) {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return isScalar(t)
+}
+
+// isScalar returns whether a single value can be bound to the type.
+func isScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		// []byte is bound as a string.
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// fieldByIndex returns the field of v with the given index, allocating nil
+// embedded struct pointers along the way.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf(
+						"jmux: bind: cannot set embedded pointer to unexported struct %s",
+						v.Type().Elem(),
+					)
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// setValue sets v to the values, converted to v's type. Empty values are
+// ignored for types other than strings. On error, returns the value that
+// failed to convert.
+func setValue(v reflect.Value, values []string, layout string) (string, error) {
+	t := v.Type()
+	if t.Kind() == reflect.Slice && !isScalar(t) {
+		s := reflect.MakeSlice(t, 0, len(values))
+		for _, value := range values {
+			if value == "" && !isString(t.Elem()) {
+				continue
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := setScalar(elem, value, layout); err != nil {
+				return value, err
+			}
+			s = reflect.Append(s, elem)
+		}
+		v.Set(s)
+		return "", nil
+	}
+	// Use the last value, as with later sources taking precedence.
+	value := values[len(values)-1]
+	if value == "" && !isString(t) {
+		return "", nil
+	}
+	if err := setScalar(v, value, layout); err != nil {
+		return value, err
+	}
+	return "", nil
+}
+
+// setScalar sets v to the value, converted to v's type.
+func setScalar(v reflect.Value, value, layout string) error {
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		if err := setScalar(p.Elem(), value, layout); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		tm, err := time.Parse(layout, value)
+		if err != nil {
+			return fmt.Errorf("expected time in format %q", layout)
+		}
+		v.Set(reflect.ValueOf(tm))
+		return nil
+	case t == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("expected duration")
+		}
+		v.SetInt(int64(d))
+		return nil
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return numError("integer", err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, t.Bits())
+		if err != nil {
+			return numError("unsigned integer", err)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, t.Bits())
+		if err != nil {
+			return numError("number", err)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		v.SetBytes([]byte(value))
+	}
+	return nil
+}
+
+// numError returns the error for a failure to parse a number of the given
+// kind.
+func numError(kind string, err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("%s out of range", kind)
+	}
+	return fmt.Errorf("expected %s", kind)
+}
+
+// isString returns whether the type (or the type it points to) is bound
+// directly from strings, so empty values are meaningful.
+func isString(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.String ||
+		(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
+
+// isJSONRequest returns whether the request has a JSON content type.
+func isJSONRequest(r *http.Request) bool {
+	mt := mediaType(r)
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// isFormRequest returns whether the request has a form content type.
+func isFormRequest(r *http.Request) bool {
+	mt := mediaType(r)
+	return mt == "application/x-www-form-urlencoded" || mt == "multipart/form-data"
+}
+
+// mediaType returns the media type of the request's content.
+func mediaType(r *http.Request) string {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt
+}
+
+// maxFormMemory is the maximum memory used to parse multipart forms, with the
+// rest of the files stored on disk.
+const maxFormMemory = 32 << 20
+
+// parseForm parses the request's form body.
+func parseForm(r *http.Request) error {
+	if mediaType(r) == "multipart/form-data" {
+		return r.ParseMultipartForm(maxFormMemory)
+	}
+	return r.ParseForm()
+}
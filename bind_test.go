@@ -0,0 +1,139 @@
+package jmux
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindPage struct {
+	Page  int  `query:"page"`
+	Limit *int `query:"limit"`
+}
+
+type bindTarget struct {
+	bindPage
+	ID      uint64        `path:"id"`
+	Tenant  string        `header:"X-Tenant"`
+	Name    string        `form:"name" json:"name"`
+	Tags    []string      `query:"tag"`
+	IDs     []int         `query:"ids"`
+	Active  bool          `query:"active"`
+	Since   time.Time     `query:"since" format:"2006-01-02"`
+	At      *time.Time    `query:"at"`
+	Timeout time.Duration `query:"timeout"`
+	Addr    netip.Addr    `header:"X-Addr"`
+	Score   float64       `json:"score"`
+	Ignored string        `query:"-"`
+}
+
+func TestBind(t *testing.T) {
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"/users/7?page=2&limit=10&tag=a&tag=b&ids=1&ids=&ids=3&active=true"+
+			"&since=2024-01-02&at=2024-01-02T03:04:05Z&timeout=1m&name=query",
+		strings.NewReader(`{"name":"json","score":1.5}`),
+	)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "acme")
+	r.Header.Set("X-Addr", "10.0.0.1")
+	c := newContext(httptest.NewRecorder(), r, map[string]string{"id": "7"})
+
+	var got bindTarget
+	got.Ignored = "unchanged"
+	if err := c.Bind(&got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limit := 10
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := bindTarget{
+		bindPage: bindPage{Page: 2, Limit: &limit},
+		ID:       7,
+		Tenant:   "acme",
+		Name:     "json",
+		Tags:     []string{"a", "b"},
+		IDs:      []int{1, 3},
+		Active:   true,
+		Since:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		At:       &at,
+		Timeout:  time.Minute,
+		Addr:     netip.MustParseAddr("10.0.0.1"),
+		Score:    1.5,
+		Ignored:  "unchanged",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	// Form values are only bound for form requests.
+	r = httptest.NewRequest(http.MethodPost, "/?page=3", strings.NewReader("name=form&page=9"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c = newContext(httptest.NewRecorder(), r, nil)
+	got = bindTarget{}
+	if err := c.Bind(&got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Name != "form" || got.Page != 3 {
+		t.Fatalf("expected form name and query page, got %+v", got)
+	}
+
+	var page bindPage
+	c = newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?page=4", nil), nil)
+	if err := c.BindQuery(&page); err != nil || page.Page != 4 {
+		t.Fatalf("expected page 4, got %+v (%v)", page, err)
+	}
+	if err := c.BindPath(&page); err != nil || page.Page != 4 {
+		t.Fatalf("expected page to be unchanged, got %+v (%v)", page, err)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"/?page=x&limit=99999999999999999999&active=maybe&since=2024",
+		strings.NewReader(`{"score":"high"}`),
+	)
+	r.Header.Set("Content-Type", "application/json")
+	c := newContext(httptest.NewRecorder(), r, map[string]string{"id": "-1"})
+
+	var got bindTarget
+	err := c.Bind(&got)
+	var be *BindError
+	if !errors.As(err, &be) {
+		t.Fatalf("expected *BindError, got %v", err)
+	}
+	tests := []struct {
+		field, source, key, value, err string
+	}{
+		{"", "json", "score", "", "cannot use string as float64"},
+		{"bindPage.Page", "query", "page", "x", "expected integer"},
+		{"bindPage.Limit", "query", "limit", "99999999999999999999", "integer out of range"},
+		{"Active", "query", "active", "maybe", "expected boolean"},
+		{"Since", "query", "since", "2024", `expected time in format "2006-01-02"`},
+		{"ID", "path", "id", "-1", "expected unsigned integer"},
+	}
+	if len(be.Errors) != len(tests) {
+		t.Fatalf("expected %d errors, got %v", len(tests), err)
+	}
+	for i, test := range tests {
+		fe := be.Errors[i]
+		if fe.Field != test.field || fe.Source != test.source || fe.Key != test.key ||
+			fe.Value != test.value || fe.Err.Error() != test.err {
+			t.Fatalf("%d: expected %+v, got %+v (%v)", i, test, fe, fe.Err)
+		}
+	}
+
+	for _, dst := range []any{nil, got, new(int), &struct {
+		M map[string]string `query:"m"`
+	}{}} {
+		err := c.Bind(dst)
+		if err == nil || errors.As(err, &be) {
+			t.Fatalf("%T: expected non-bind error, got %v", dst, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package jmux
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+)
+
+// CaseMode is how the case of static slugs in request paths is matched.
+type CaseMode uint8
+
+const (
+	// CaseSensitive matches static slugs only if their case is the same as
+	// registered. This is the default.
+	CaseSensitive CaseMode = iota
+	// CaseInsensitive matches static slugs without regard to case (e.g., a
+	// request for "/USERS/42" matches a route of "/users/{id}"). Static slugs
+	// with the same case as the request are preferred over those without.
+	CaseInsensitive
+	// CaseRedirect redirects requests that only match a route without regard
+	// to the case of static slugs to the path with the registered case (e.g.,
+	// a request for "/USERS/42" is redirected to "/users/42" with a route of
+	// "/users/{id}"). Requests that would fall back to a HandleAny handler or
+	// to the default handler for a prefix (see Router.DefaultPrefix) are
+	// redirected as well, with the slugs past the route kept as is. The
+	// redirect status and query are the same as for WithRedirect.
+	CaseRedirect
+)
+
+// WithCaseMode sets how the case of static slugs in request paths is matched.
+// Parameter values are always passed on as they are in the request. Defaults
+// to CaseSensitive.
+func WithCaseMode(mode CaseMode) RouterOption {
+	return func(router *Router) {
+		router.caseMode = mode
+	}
+}
+
+// casePath returns the path with the registered case to redirect the request
+// to, if any. The path is the request's path without the leading slash.
+// Params is used as scratch space.
+func (router *Router) casePath(
+	s *snapshot, r *http.Request, urlPath string, params *[]pathParam,
+) (string, bool) {
+	if s.foldTree == nil || r.Method == http.MethodConnect ||
+		strings.TrimPrefix(router.requestPath(r), "/") != urlPath {
+		return "", false
+	}
+	*params = (*params)[:0]
+	n := router.match(s.foldTree, urlPath, r, params)
+	if n == nil {
+		*params = (*params)[:0]
+		n = router.walk(s.foldTree, urlPath, r.Method, params)
+		if n == nil || !router.hasParentMatch(n, r.Method) {
+			*params = (*params)[:0]
+			n = router.findDefault(s.foldTree, urlPath, r.Method, params)
+			if n == nil {
+				return "", false
+			}
+		}
+	}
+	p := canonicalPath(n, urlPath, router.escapedPath)
+	return p, p != "/"+urlPath
+}
+
+// hasParentMatch returns whether a request falling back from the node would
+// be handled by a HandleAny handler.
+func (router *Router) hasParentMatch(n *node, method string) bool {
+	if n.getParentMatch(method) != nil {
+		return true
+	}
+	return method == http.MethodHead && router.autoHead &&
+		n.getParentMatch(http.MethodGet) != nil
+}
+
+// canonicalPath returns the path (without the leading slash) with the slugs
+// matched by the node and its parents replaced by their registered static
+// slugs, which are escaped if escape is true. Parameter values and slugs past
+// the node are kept as is.
+func canonicalPath(n *node, path string, escape bool) string {
+	var chain []*node
+	for ; n.parent != nil; n = n.parent {
+		chain = append(chain, n)
+	}
+	slugs := make([]string, 0, len(chain)+1)
+	for i := len(chain) - 1; i >= 0 && path != ""; i-- {
+		if chain[i].catchAll {
+			break
+		}
+		slug, rest := nextSegment(path)
+		if !chain[i].param {
+			slug = chain[i].name
+			if escape && slug != "/" {
+				slug = urlpkg.PathEscape(slug)
+			}
+		}
+		if slug == "/" {
+			slug = ""
+		}
+		slugs = append(slugs, slug)
+		path = rest
+	}
+	if path == "/" {
+		slugs = append(slugs, "")
+	} else if path != "" {
+		slugs = append(slugs, path)
+	}
+	return "/" + strings.Join(slugs, "/")
+}
@@ -0,0 +1,91 @@
+package jmux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCaseMode(t *testing.T) {
+	newRouter := func(mode CaseMode) *Router {
+		router := NewRouter(WithCaseMode(mode))
+		router.GetFunc("/users/{id}", func(c *Context) {
+			c.WriteString("user=" + c.Params["id"])
+		})
+		router.GetFunc("/Files/{path...}", func(c *Context) {
+			c.WriteString("file=" + c.Params["path"])
+		})
+		router.GetFunc("/about/", func(c *Context) {
+			c.WriteString("about")
+		})
+		router.GetFunc("/case", func(c *Context) {
+			c.WriteString("lower")
+		})
+		router.GetFunc("/CASE", func(c *Context) {
+			c.WriteString("upper")
+		})
+		router.PostFunc("/items", func(c *Context) {
+			c.WriteString("items")
+		})
+		router.Group("/api", nil).DefaultFunc(MethodsAll(), func(c *Context) {
+			c.WriteString("api")
+		})
+		return router
+	}
+
+	tests := []struct {
+		mode           CaseMode
+		method, target string
+		code           int
+		body, location string
+	}{
+		{CaseSensitive, http.MethodGet, "/users/Ab", http.StatusOK, "user=Ab", ""},
+		{CaseSensitive, http.MethodGet, "/USERS/Ab", http.StatusNotFound, "", ""},
+		{CaseSensitive, http.MethodGet, "/API/x", http.StatusNotFound, "", ""},
+
+		{CaseInsensitive, http.MethodGet, "/USERS/Ab", http.StatusOK, "user=Ab", ""},
+		{CaseInsensitive, http.MethodGet, "/Users/42", http.StatusOK, "user=42", ""},
+		{CaseInsensitive, http.MethodGet, "/files/A/B", http.StatusOK, "file=A/B", ""},
+		{CaseInsensitive, http.MethodGet, "/ABOUT/", http.StatusOK, "about", ""},
+		{CaseInsensitive, http.MethodGet, "/case", http.StatusOK, "lower", ""},
+		{CaseInsensitive, http.MethodGet, "/CASE", http.StatusOK, "upper", ""},
+		{CaseInsensitive, http.MethodGet, "/Api/x", http.StatusOK, "api", ""},
+		{CaseInsensitive, http.MethodGet, "/ITEMS", http.StatusMethodNotAllowed, "", ""},
+
+		{CaseRedirect, http.MethodGet, "/users/Ab", http.StatusOK, "user=Ab", ""},
+		{CaseRedirect, http.MethodGet, "/USERS/Ab?x=1", http.StatusMovedPermanently, "", "/users/Ab?x=1"},
+		{CaseRedirect, http.MethodGet, "/files/A/B/", http.StatusMovedPermanently, "", "/Files/A/B/"},
+		{CaseRedirect, http.MethodGet, "/About/", http.StatusMovedPermanently, "", "/about/"},
+		{CaseRedirect, http.MethodGet, "/CASE", http.StatusOK, "upper", ""},
+		{CaseRedirect, http.MethodPost, "/Items", http.StatusPermanentRedirect, "", "/items"},
+		{CaseRedirect, http.MethodGet, "/API/X/y", http.StatusMovedPermanently, "", "/api/X/y"},
+		{CaseRedirect, http.MethodGet, "/api/X/y", http.StatusOK, "api", ""},
+		{CaseRedirect, http.MethodGet, "/Other", http.StatusNotFound, "", ""},
+	}
+	routers := make(map[CaseMode]*Router)
+	for _, test := range tests {
+		router := routers[test.mode]
+		if router == nil {
+			router = newRouter(test.mode)
+			routers[test.mode] = router
+		}
+		rec := serveRecorder(router, test.method, test.target)
+		if rec.Code != test.code {
+			t.Fatalf(
+				"mode %d: %s %s: expected %d, got %d",
+				test.mode, test.method, test.target, test.code, rec.Code,
+			)
+		}
+		if body := rec.Body.String(); body != test.body {
+			t.Fatalf(
+				"mode %d: %s %s: expected %q, got %q",
+				test.mode, test.method, test.target, test.body, body,
+			)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.location {
+			t.Fatalf(
+				"mode %d: %s %s: expected location %q, got %q",
+				test.mode, test.method, test.target, test.location, loc,
+			)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package jmux
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Constraint checks whether the value of a path parameter is valid. Requests
+// whose parameter values fail a route's constraint don't match the route.
+type Constraint func(value string) bool
+
+// builtinConstraints are the named constraints every router starts with.
+var builtinConstraints = map[string]Constraint{
+	"int": func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	},
+	"uint": func(value string) bool {
+		_, err := strconv.ParseUint(value, 10, 64)
+		return err == nil
+	},
+	"float": func(value string) bool {
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	},
+	"bool": func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	},
+	"uuid":  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	"alpha": regexp.MustCompile(`^[a-zA-Z]+$`).MatchString,
+	"alnum": regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString,
+}
+
+var constraintNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Constraint registers a named constraint that can be used in patterns (e.g.,
+// "{id:name}"). Constraints are resolved when a pattern is registered, so a
+// constraint must be registered before any pattern that uses it. The
+// following constraints are registered by default: int, uint, float, bool,
+// uuid, alpha, and alnum. Registering a constraint with the same name as an
+// existing one replaces it.
+func (router *Router) Constraint(name string, c Constraint) {
+	if !constraintNameRegexp.MatchString(name) {
+		panic("invalid constraint name: " + name)
+	}
+	router.mtx.Lock()
+	router.constraints[name] = c
+	router.mtx.Unlock()
+}
+
+// compileConstraint returns the constraint for the given spec (what follows
+// the colon in a parameter). The spec is either the name of a registered
+// constraint or a regular expression that must match the entire value.
+func (router *Router) compileConstraint(spec string) (Constraint, error) {
+	if c, ok := router.constraints[spec]; ok {
+		return c, nil
+	}
+	if constraintNameRegexp.MatchString(spec) {
+		return nil, fmt.Errorf("unknown constraint %q", spec)
+	}
+	re, err := regexp.Compile("^(?:" + spec + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint regexp %q: %w", spec, err)
+	}
+	return re.MatchString, nil
+}
+
+func cloneConstraints(constraints map[string]Constraint) map[string]Constraint {
+	m := make(map[string]Constraint, len(constraints))
+	for name, c := range constraints {
+		m[name] = c
+	}
+	return m
+}
@@ -0,0 +1,270 @@
+package jmux
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// HandlerFuncE is the type for a jmux handler function that returns an error.
+// Returned errors are passed to the error handler of the router routing the
+// request (see Router.ErrorHandler).
+type HandlerFuncE func(*Context) error
+
+// ServeHTTP implements the ServeHTTP function for the http.Handler interface.
+// Returned errors are handled by DefaultErrorHandler.
+func (h HandlerFuncE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.ServeC(newContext(w, r, make(map[string]string)))
+}
+
+// ServeC implements the ServeC function for the jmux Handler interface.
+func (h HandlerFuncE) ServeC(c *Context) {
+	w := c.Writer
+	if _, ok := w.(*responseWriter); !ok {
+		// Track the response so that the error handler knows if it started.
+		c.Writer = &responseWriter{ResponseWriter: w}
+	}
+	if err := h(c); err != nil {
+		c.handleError(err)
+	}
+	c.Writer = w
+}
+
+// ErrorHandler handles an error returned by a HandlerFuncE, usually by
+// writing a response for it. It is called even if the response has already
+// started (see Context.ResponseStarted), in which case it should only record
+// the error.
+type ErrorHandler func(c *Context, err error)
+
+// ErrorHandler sets the handler for errors returned by HandlerFuncE handlers.
+// Passing nil restores the default, DefaultErrorHandler.
+func (router *Router) ErrorHandler(h ErrorHandler) {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	router.errorHandler = h
+	router.markDirty()
+}
+
+// handleError handles the error using the error handler of the router routing
+// the request, or DefaultErrorHandler if there is none.
+func (c *Context) handleError(err error) {
+	if c.router != nil {
+		if h := c.router.getSnapshot().errorHandler; h != nil {
+			h(c, err)
+			return
+		}
+	}
+	DefaultErrorHandler(c, err)
+}
+
+// DefaultErrorHandler writes a response for the error, unless the response
+// has already started (see Context.ResponseStarted). Errors are found using
+// errors.As, so they may be wrapped:
+//   - a *Problem is written using the router's error renderer, or
+//     Context.WriteProblem if there isn't one
+//   - an *HTTPError is written with its status code and message (see
+//     Context.WriteError)
+//   - a *ValidationError, *BindError, or JSON decoding error (e.g., from
+//     ReadBodyJSON) is written using Context.WriteRequestError
+//
+// Any other error is written as an InternalServerError (500), without
+// details.
+func DefaultErrorHandler(c *Context, err error) {
+	if c.ResponseStarted() {
+		return
+	}
+	var (
+		p         *Problem
+		he        *HTTPError
+		ve        *ValidationError
+		be        *BindError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &p):
+		if r := c.errorRenderer(); r != nil {
+			r(c, p)
+		} else {
+			c.WriteProblem(p)
+		}
+	case errors.As(err, &he):
+		c.writeStatusError(he.Status, he.Message)
+	case errors.As(err, &ve), errors.As(err, &be),
+		errors.As(err, &syntaxErr), errors.As(err, &typeErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		c.WriteRequestError(err)
+	default:
+		c.writeStatusError(http.StatusInternalServerError, "")
+	}
+}
+
+// HTTPError is an error with the HTTP status code and message to respond
+// with. The underlying error, if any, isn't sent to the client.
+type HTTPError struct {
+	// Status is the HTTP status code.
+	Status int
+	// Message is the message sent to the client. If empty, only the status
+	// code is sent.
+	Message string
+	// Err is the underlying error.
+	Err error
+}
+
+// NewHTTPError creates a new HTTP error with the status code and message.
+func NewHTTPError(status int, msg string) *HTTPError {
+	return &HTTPError{Status: status, Message: msg}
+}
+
+// WrapHTTPError creates a new HTTP error with the status code and underlying
+// error, and without a message.
+func WrapHTTPError(status int, err error) *HTTPError {
+	return &HTTPError{Status: status, Err: err}
+}
+
+// Error returns the error as a string.
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseStarted returns whether the response's status code or any of its
+// body has been written. Writes are only tracked while a HandlerFuncE is
+// running or by routers that recover from panics (see WithRecovery), so false
+// is always returned otherwise.
+func (c *Context) ResponseStarted() bool {
+	w := c.Writer
+	for {
+		switch ww := w.(type) {
+		case *responseWriter:
+			return ww.started
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = ww.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// responseWriter tracks whether a response has started.
+type responseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	// Informational responses don't start the final response.
+	if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+		w.started = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush flushes the underlying response writer, if it supports it.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying response writer's connection, if it supports
+// it.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.started = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying response writer (for use by
+// http.ResponseController).
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HandleE handles the given pattern with the given HandlerFuncE for the given
+// methods. See Handle.
+func (router *Router) HandleE(pattern string, methods Methods, f HandlerFuncE) *Route {
+	return router.Handle(pattern, methods, f)
+}
+
+// GetE is the same as Get but takes a HandlerFuncE.
+func (router *Router) GetE(pattern string, f HandlerFuncE) *Route {
+	return router.HandleE(pattern, MethodsGet(), f)
+}
+
+// PostE is the same as Post but takes a HandlerFuncE.
+func (router *Router) PostE(pattern string, f HandlerFuncE) *Route {
+	return router.HandleE(pattern, MethodsPost(), f)
+}
+
+// PutE is the same as Put but takes a HandlerFuncE.
+func (router *Router) PutE(pattern string, f HandlerFuncE) *Route {
+	return router.HandleE(pattern, MethodsPut(), f)
+}
+
+// DeleteE is the same as Delete but takes a HandlerFuncE.
+func (router *Router) DeleteE(pattern string, f HandlerFuncE) *Route {
+	return router.HandleE(pattern, MethodsDelete(), f)
+}
+
+// AllE is the same as All but takes a HandlerFuncE.
+func (router *Router) AllE(pattern string, f HandlerFuncE) *Route {
+	return router.HandleE(pattern, MethodsAll(), f)
+}
+
+// HandleE handles the given pattern with the given HandlerFuncE for the given
+// methods. See Group.Handle.
+func (g *Group) HandleE(pattern string, methods Methods, f HandlerFuncE) *Route {
+	return g.Handle(pattern, methods, f)
+}
+
+// GetE is the same as Get but takes a HandlerFuncE.
+func (g *Group) GetE(pattern string, f HandlerFuncE) *Route {
+	return g.HandleE(pattern, MethodsGet(), f)
+}
+
+// PostE is the same as Post but takes a HandlerFuncE.
+func (g *Group) PostE(pattern string, f HandlerFuncE) *Route {
+	return g.HandleE(pattern, MethodsPost(), f)
+}
+
+// PutE is the same as Put but takes a HandlerFuncE.
+func (g *Group) PutE(pattern string, f HandlerFuncE) *Route {
+	return g.HandleE(pattern, MethodsPut(), f)
+}
+
+// DeleteE is the same as Delete but takes a HandlerFuncE.
+func (g *Group) DeleteE(pattern string, f HandlerFuncE) *Route {
+	return g.HandleE(pattern, MethodsDelete(), f)
+}
+
+// AllE is the same as All but takes a HandlerFuncE.
+func (g *Group) AllE(pattern string, f HandlerFuncE) *Route {
+	return g.HandleE(pattern, MethodsAll(), f)
+}
@@ -0,0 +1,119 @@
+package jmux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerFuncE(t *testing.T) {
+	errTeapot := errors.New("teapot")
+	router := NewRouter()
+	router.GetE("/users/{id}", func(c *Context) error {
+		switch id := c.Params["id"]; id {
+		case "missing":
+			return fmt.Errorf("loading user: %w", NewHTTPError(http.StatusNotFound, "no such user"))
+		case "conflict":
+			return WrapHTTPError(http.StatusConflict, errors.New("internal detail"))
+		case "problem":
+			p := NewProblem(http.StatusForbidden, "no access")
+			p.Type = "https://example.com/probs/access"
+			return p
+		case "invalid":
+			return c.Validate(&struct {
+				Name string `json:"name" validate:"required"`
+			}{})
+		case "started":
+			c.WriteString("partial")
+			return errors.New("failed midway")
+		case "teapot":
+			return errTeapot
+		case "secret":
+			return errors.New("secret")
+		default:
+			_, err := c.WriteString("user=" + id)
+			return err
+		}
+	})
+	router.Group("/g", nil).PostE("/create", func(c *Context) error {
+		var v struct{}
+		return c.ReadBodyJSON(&v)
+	})
+
+	tests := []struct {
+		method, target string
+		code           int
+		want           string
+	}{
+		{http.MethodGet, "/users/1", http.StatusOK, "user=1"},
+		{http.MethodGet, "/users/missing", http.StatusNotFound, "no such user\n"},
+		{http.MethodGet, "/users/conflict", http.StatusConflict, ""},
+		{http.MethodGet, "/users/problem", http.StatusForbidden,
+			`{"detail":"no access","status":403,"title":"Forbidden","type":"https://example.com/probs/access"}`},
+		{http.MethodGet, "/users/invalid", http.StatusUnprocessableEntity,
+			`{"errors":[{"pointer":"/name","field":"Name","rule":"required","message":"is required"}]}` + "\n"},
+		{http.MethodGet, "/users/started", http.StatusOK, "partial"},
+		{http.MethodGet, "/users/secret", http.StatusInternalServerError, ""},
+		{http.MethodPost, "/g/create", http.StatusBadRequest,
+			`{"errors":[{"source":"json","message":"EOF"}]}` + "\n"},
+	}
+	check := func(router *Router) {
+		t.Helper()
+		for _, test := range tests {
+			rec := serveRecorder(router, test.method, test.target)
+			if rec.Code != test.code {
+				t.Fatalf("%s %s: expected %d, got %d", test.method, test.target, test.code, rec.Code)
+			}
+			if body := rec.Body.String(); body != test.want {
+				t.Fatalf("%s %s: expected %q, got %q", test.method, test.target, test.want, body)
+			}
+		}
+	}
+	check(router)
+
+	var handled []string
+	router.ErrorHandler(func(c *Context, err error) {
+		handled = append(handled, err.Error())
+		if errors.Is(err, errTeapot) {
+			c.WriteHeader(http.StatusTeapot)
+			return
+		}
+		DefaultErrorHandler(c, err)
+	})
+	check(router)
+	if rec := serveRecorder(router, http.MethodGet, "/users/teapot"); rec.Code != http.StatusTeapot {
+		t.Fatalf("expected 418, got %d", rec.Code)
+	}
+	if len(handled) != len(tests) {
+		t.Fatalf("expected every error to be handled, got %q", handled)
+	}
+	if !strings.Contains(handled[0], "loading user: no such user") {
+		t.Fatalf("expected wrapped error, got %q", handled[0])
+	}
+
+	// Host routers inherit the error handler.
+	router.Host("api.example.com").GetE("/", func(c *Context) error {
+		return errTeapot
+	})
+	if rec := serveRecorder(router, http.MethodGet, "http://api.example.com/"); rec.Code != http.StatusTeapot {
+		t.Fatalf("expected host router to inherit the error handler, got %d", rec.Code)
+	}
+
+	router.ErrorHandler(nil)
+	check(router)
+	if name := handlerName(HandlerFuncE(func(*Context) error { return nil })); !strings.Contains(name, "TestHandlerFuncE") {
+		t.Fatalf("unexpected handler name %q", name)
+	}
+
+	// Outside of a router, errors are handled by the default handler.
+	rec := httptest.NewRecorder()
+	HandlerFuncE(func(c *Context) error {
+		return NewHTTPError(http.StatusTooManyRequests, "slow down")
+	}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusTooManyRequests || rec.Body.String() != "slow down\n" {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+	}
+}
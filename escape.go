@@ -0,0 +1,54 @@
+package jmux
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+)
+
+// WithEscapedPath sets whether the router routes requests using the escaped
+// form of their paths (see url.URL.EscapedPath) rather than the decoded form.
+// When enabled, paths are only split on literal slashes, so an escaped slash
+// ("%2F") is part of a slug rather than a separator (e.g., a request for
+// "/files/a%2Fb" matches "/files/{key}" with a key of "a/b"). Each slug is
+// unescaped before being matched, so static slugs and param values are
+// matched and passed on decoded. Catch-all params are unescaped as a whole.
+// Routers mounted on a router routing escaped paths are passed the escaped
+// remainder of the path, so they should enable this as well. Disabled by
+// default.
+func WithEscapedPath(enabled bool) RouterOption {
+	return func(router *Router) {
+		router.escapedPath = enabled
+	}
+}
+
+// requestPath returns the path of the request to route.
+func (router *Router) requestPath(r *http.Request) string {
+	if router.escapedPath {
+		return r.URL.EscapedPath()
+	}
+	return r.URL.Path
+}
+
+// unescape unescapes the slug if the router routes escaped paths.
+func (router *Router) unescape(slug string) string {
+	if !router.escapedPath || strings.IndexByte(slug, '%') == -1 {
+		return slug
+	}
+	if unescaped, err := urlpkg.PathUnescape(slug); err == nil {
+		return unescaped
+	}
+	return slug
+}
+
+// matchParam matches the parameter node against the slug (already unescaped)
+// of the path, where rest is what follows the slug. Catch-all params, other
+// than those used for mounting routers, are unescaped as a whole.
+func (router *Router) matchParam(
+	n *node, slug, rest, path string, params *[]pathParam,
+) (string, bool) {
+	if n.catchAll && n.name != mountParam {
+		path = router.unescape(path)
+	}
+	return n.matchSlug(slug, rest, path, params)
+}
@@ -0,0 +1,78 @@
+package jmux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEscapedPath(t *testing.T) {
+	newRouter := func(escaped bool) *Router {
+		router := NewRouter(
+			WithEscapedPath(escaped), WithRedirect(RedirectTrailingSlash),
+		)
+		router.GetFunc("/files/{key}", func(c *Context) {
+			c.WriteString("key=" + c.Params["key"])
+		})
+		router.GetFunc("/files/{key}/meta", func(c *Context) {
+			c.WriteString("meta=" + c.Params["key"])
+		})
+		router.GetFunc("/static/{path...}", func(c *Context) {
+			c.WriteString("path=" + c.Params["path"])
+		})
+		router.GetFunc("/café/{name}", func(c *Context) {
+			c.WriteString("café=" + c.Params["name"])
+		})
+		router.GetFunc("/a+b/{name}.{ext}", func(c *Context) {
+			c.WriteString("name=" + c.Params["name"] + " ext=" + c.Params["ext"])
+		})
+		return router
+	}
+
+	tests := []struct {
+		escaped        bool
+		target         string
+		code           int
+		body, location string
+	}{
+		{true, "/files/a%2Fb", http.StatusOK, "key=a/b", ""},
+		{true, "/files/a%2Fb/meta", http.StatusOK, "meta=a/b", ""},
+		{true, "/files/100%25", http.StatusOK, "key=100%", ""},
+		{true, "/files/100%252F", http.StatusOK, "key=100%2F", ""},
+		{true, "/files/a%20b", http.StatusOK, "key=a b", ""},
+		{true, "/files/a+b", http.StatusOK, "key=a+b", ""},
+		{true, "/static/a%2Fb/c%25", http.StatusOK, "path=a/b/c%", ""},
+		{true, "/caf%C3%A9/%E2%9C%93", http.StatusOK, "café=✓", ""},
+		{true, "/café/✓", http.StatusOK, "café=✓", ""},
+		{true, "/a+b/x%2Fy.tar%2Egz", http.StatusOK, "name=x/y ext=tar.gz", ""},
+		{true, "/files/a%2Fb/", http.StatusMovedPermanently, "", "/files/a%2Fb"},
+
+		// Without routing on escaped paths, escaped slashes split slugs.
+		{false, "/files/a%2Fb", http.StatusNotFound, "", ""},
+		{false, "/files/a%2Fb/meta", http.StatusNotFound, "", ""},
+		{false, "/files/100%25", http.StatusOK, "key=100%", ""},
+		{false, "/caf%C3%A9/%E2%9C%93", http.StatusOK, "café=✓", ""},
+		{false, "/static/a%2Fb/c%25", http.StatusOK, "path=a/b/c%", ""},
+	}
+	routers := map[bool]*Router{true: newRouter(true), false: newRouter(false)}
+	for _, test := range tests {
+		rec := serveRecorder(routers[test.escaped], http.MethodGet, test.target)
+		if rec.Code != test.code {
+			t.Fatalf(
+				"escaped %v: %s: expected %d, got %d",
+				test.escaped, test.target, test.code, rec.Code,
+			)
+		}
+		if body := rec.Body.String(); body != test.body {
+			t.Fatalf(
+				"escaped %v: %s: expected %q, got %q",
+				test.escaped, test.target, test.body, body,
+			)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.location {
+			t.Fatalf(
+				"escaped %v: %s: expected location %q, got %q",
+				test.escaped, test.target, test.location, loc,
+			)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package jmux
+
+import "strings"
+
+// RoutingFailure is the reason a request failed to match a route's handler.
+type RoutingFailure uint8
+
+const (
+	// FailureNone means the request matched a route's handler.
+	FailureNone RoutingFailure = iota
+	// FailureNoPath means no route has handlers for the request's path.
+	FailureNoPath
+	// FailureWrongMethod means a route has handlers for the request's path,
+	// but not for its method. These requests are handled by HandleAny or
+	// MethodNotAllowed handlers, never by default handlers (see
+	// Router.Default), so only those see this failure.
+	FailureWrongMethod
+	// FailureMatcherRejected means a route has handlers for the request's path
+	// and method, but they all have matchers that rejected the request (see
+	// Route.Headers).
+	FailureMatcherRejected
+)
+
+// String returns the name of the failure.
+func (f RoutingFailure) String() string {
+	switch f {
+	case FailureNone:
+		return "none"
+	case FailureNoPath:
+		return "no path"
+	case FailureWrongMethod:
+		return "wrong method"
+	case FailureMatcherRejected:
+		return "matcher rejected"
+	}
+	return "unknown"
+}
+
+// Failure returns why routing the request failed, for use by fallback
+// handlers (HandleAny, Default, MethodNotAllowed, and NotFound handlers).
+// Returns FailureNone if the request matched a route's handler.
+func (c *Context) Failure() RoutingFailure {
+	return c.failure
+}
+
+// DefaultPrefix sets the default handler for the given methods for requests
+// under the given prefix (e.g., "/api" for "/api" and "/api/users/1") that
+// don't match any other route (see Router.Default). The handler for the
+// longest prefix of the path is used, falling back to the router's default
+// handlers. Trailing slashes on the prefix are ignored, so "/api/" is the
+// same as "/api". The prefix may have parameters (e.g., "/tenants/{tenant}").
+// The handler is passed the params matched before routing failed (see
+// Router.Default), along with those matched by the prefix, which take
+// precedence. Prefixes match regardless of the methods of the routes under
+// them. Unlike HandleAny handlers, default handlers aren't used for requests
+// for paths that only exist for other methods (which get the
+// MethodNotAllowed handler).
+// Returns the route for the prefix.
+func (router *Router) DefaultPrefix(prefix string, methods Methods, h Handler) *Route {
+	prefix = joinPattern("", prefix)
+	if prefix != "/" {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	route, err := router.register(prefix, make(Methods), nil, nil, false)
+	if err != nil {
+		panic(err)
+	}
+	if route.defaults == nil {
+		route.defaults = make(map[string]Handler)
+	}
+	for method := range methods {
+		route.defaults[method] = h
+	}
+	route.compose()
+	return route
+}
+
+// DefaultPrefixFunc is the same as DefaultPrefix but takes a HandlerFunc.
+func (router *Router) DefaultPrefixFunc(prefix string, methods Methods, f HandlerFunc) *Route {
+	return router.DefaultPrefix(prefix, methods, f)
+}
@@ -0,0 +1,117 @@
+package jmux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDefaultPrefix(t *testing.T) {
+	router := NewRouter()
+	report := func(scope string) HandlerFunc {
+		return func(c *Context) {
+			c.WriteString(
+				scope + " " + c.Failure().String() + " " + c.Params["tenant"] + c.Params["id"],
+			)
+		}
+	}
+	router.GetFunc("/api/users", func(c *Context) {
+		c.WriteString("users")
+	})
+	router.GetFunc("/api/users/{id}", func(c *Context) {
+		c.WriteString("user")
+	})
+	router.GetFunc("/x/{id}/y", func(c *Context) {
+		c.WriteString("y")
+	})
+	router.GetFunc("/api/items", func(c *Context) {
+		c.WriteString("items")
+	}).Headers("Accept", "application/json")
+	router.GetFunc("/tenants/{tenant}/home", func(c *Context) {
+		c.WriteString("home")
+	})
+	router.DefaultFunc(MethodsAll(), report("global"))
+	router.DefaultPrefixFunc("/api/", MethodsAll(), report("api"))
+	router.DefaultPrefixFunc("/api/v2", MethodsGet(), report("api/v2"))
+	router.DefaultPrefixFunc("/tenants/{tenant}", MethodsAll(), report("tenant"))
+	router.DefaultPrefixFunc("/v1/deep", MethodsAll(), report("deep"))
+	router.DefaultPrefixFunc("/orgs/{tenant}/teams", MethodsPost(), report("teams"))
+	shop := router.Group("/shop", nil)
+	shop.GetFunc("/cart", func(c *Context) {
+		c.WriteString("cart")
+	})
+	shop.DefaultFunc(MethodsAll(), report("shop"))
+	router.MethodNotAllowedFunc(func(c *Context) {
+		c.WriteError(http.StatusMethodNotAllowed, c.Failure().String())
+	})
+
+	tests := []struct {
+		method, path, want string
+		code               int
+	}{
+		{http.MethodGet, "/api/users", "users", http.StatusOK},
+		{http.MethodGet, "/api/other", "api no path ", http.StatusOK},
+		// Defaults get the params matched before routing failed.
+		{http.MethodGet, "/api/users/1/extra", "api no path 1", http.StatusOK},
+		{http.MethodGet, "/x/1/z", "global no path 1", http.StatusOK},
+		{http.MethodGet, "/tenants/acme/home/x", "tenant no path acme", http.StatusOK},
+		{http.MethodGet, "/api", "api no path ", http.StatusOK},
+		{http.MethodGet, "/api/v2/x/y", "api/v2 no path ", http.StatusOK},
+		{http.MethodPost, "/api/v2/x", "api no path ", http.StatusOK},
+		{http.MethodGet, "/api/items", "api matcher rejected ", http.StatusOK},
+		{http.MethodPost, "/api/users", "wrong method\n", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/tenants/acme/other", "tenant no path acme", http.StatusOK},
+		{http.MethodGet, "/tenants/acme/home", "home", http.StatusOK},
+		{http.MethodPost, "/tenants/acme/x", "tenant no path acme", http.StatusOK},
+		{http.MethodGet, "/v1/deep/x", "deep no path ", http.StatusOK},
+		{http.MethodGet, "/v1/other", "global no path ", http.StatusOK},
+		{http.MethodPost, "/orgs/acme/teams/a/b", "teams no path acme", http.StatusOK},
+		{http.MethodGet, "/orgs/acme/teams/a", "global no path ", http.StatusOK},
+		{http.MethodGet, "/shop/other", "shop no path ", http.StatusOK},
+		{http.MethodPost, "/shop/cart", "wrong method\n", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/other", "global no path ", http.StatusOK},
+		{http.MethodGet, "/apix", "global no path ", http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, test.method, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s %s: expected %d, got %d", test.method, test.path, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s %s: expected %q, got %q", test.method, test.path, test.want, body)
+		}
+	}
+}
+
+func TestFailure(t *testing.T) {
+	router := NewRouter()
+	var failure RoutingFailure
+	record := func(c *Context) {
+		failure = c.Failure()
+	}
+	router.GetFunc("/a", record)
+	router.GetFunc("/a/b", record).Queries("x", "1")
+	router.GetFunc("/c/d", record)
+	router.Group("/c", nil).Route().HandleAnyFunc(MethodsAll(), record)
+	router.NotFoundFunc(record)
+	router.MethodNotAllowedFunc(record)
+
+	tests := []struct {
+		method, path string
+		want         RoutingFailure
+	}{
+		{http.MethodGet, "/a", FailureNone},
+		{http.MethodGet, "/none", FailureNoPath},
+		{http.MethodPut, "/a", FailureWrongMethod},
+		{http.MethodGet, "/a/b", FailureMatcherRejected},
+		{http.MethodGet, "/a/b?x=1", FailureNone},
+		{http.MethodGet, "/c/e", FailureNoPath},
+		{http.MethodPost, "/c/d", FailureWrongMethod},
+	}
+	for _, test := range tests {
+		failure = 255
+		serveRecorder(router, test.method, test.path)
+		if failure != test.want {
+			t.Fatalf("%s %s: expected %v, got %v", test.method, test.path, test.want, failure)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package jmux
+
+import "strings"
+
+// mountParam is the name of the catch-all parameter used to capture the path
+// remaining for a mounted router.
+const mountParam = "jmux.mount"
+
+// Group is a group of routes sharing a common prefix.
+type Group struct {
+	router *Router
+	prefix string
+	// The group the group is nested in, if any
+	parent     *Group
+	middleware []Middleware
+}
+
+// Group creates a group of routes under the given prefix, calling fn with the
+// group (if fn isn't nil). Returns the created group.
+func (router *Router) Group(prefix string, fn func(*Group)) *Group {
+	g := &Group{router: router, prefix: joinPattern("", prefix)}
+	if fn != nil {
+		fn(g)
+	}
+	return g
+}
+
+// Mount mounts the sub-router under the given prefix. All requests for the
+// prefix, or anything under it, are passed to the sub-router, which routes
+// what remains of the path after the prefix (e.g., with a prefix of "/api", a
+// request for "/api/users" is routed as "/users", and requests for "/api" and
+// "/api/" are routed as "/"). Any params matched in the prefix are passed on
+// to the sub-router's handlers. The sub-router uses the router's validation
+// rules (see Router.Rule) for names it has no rules of its own for (if it's
+// mounted more than once, the router it was last mounted in). A catch-all
+// parameter directly under the prefix (e.g., "/api/{rest...}") would take the
+// mounted router's requests, so registering one conflicts with the mount (as
+// does mounting a router where one is registered), regardless of strict
+// mode. Returns the route for the prefix.
+func (router *Router) Mount(prefix string, sub *Router) *Route {
+	sub.setRuleParent(router)
+	prefix = joinPattern("", prefix)
+	h := mountHandler(sub)
+	router.getRoute(joinPattern(prefix, "/{"+mountParam+"...}"), MethodsAll(), h)
+	return router.getRoute(prefix, MethodsAll(), h)
+}
+
+// mountHandler returns the handler used to pass requests to a mounted router.
+func mountHandler(sub *Router) Handler {
+	return HandlerFunc(func(c *Context) {
+		path := c.Params[mountParam]
+		delete(c.Params, mountParam)
+		sub.serve(c.Writer, c.Request, path, c.Params)
+	})
+}
+
+// Prefix returns the group's prefix.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Group creates a group nested in the group, with the given prefix appended
+// to the group's prefix.
+func (g *Group) Group(prefix string, fn func(*Group)) *Group {
+	ng := &Group{
+		router: g.router,
+		prefix: joinPattern(g.prefix, prefix),
+		parent: g,
+	}
+	if fn != nil {
+		fn(ng)
+	}
+	return ng
+}
+
+// Mount mounts the sub-router under the given prefix, appended to the group's
+// prefix. See Router.Mount.
+func (g *Group) Mount(prefix string, sub *Router) *Route {
+	sub.setRuleParent(g.router)
+	prefix = joinPattern(g.prefix, prefix)
+	h := g.wrap(mountHandler(sub))
+	g.router.getRoute(joinPattern(prefix, "/{"+mountParam+"...}"), MethodsAll(), h)
+	return g.router.getRoute(prefix, MethodsAll(), h)
+}
+
+// Route returns the route for the group's prefix.
+func (g *Group) Route() *Route {
+	return g.router.getRoute(g.prefix, make(Methods), nil)
+}
+
+// Default sets the default handler for the given methods for requests under
+// the group's prefix that don't match any other route. This is equivalent to
+// calling Router.DefaultPrefix with the group's prefix.
+func (g *Group) Default(methods Methods, h Handler) {
+	g.router.DefaultPrefix(g.prefix, methods, g.wrap(h))
+}
+
+// Handle handles the given pattern, appended to the group's prefix. A pattern
+// of "" handles the prefix itself, while a pattern of "/" handles the prefix
+// with a trailing slash. See Router.Handle.
+func (g *Group) Handle(pattern string, methods Methods, h Handler) *Route {
+	return g.router.getRoute(joinPattern(g.prefix, pattern), methods, g.wrap(h))
+}
+
+// Get handles the given pattern with the given handler for GET requests.
+func (g *Group) Get(pattern string, h Handler) *Route {
+	return g.Handle(pattern, MethodsGet(), h)
+}
+
+// Post handles the given pattern with the given handler for POST requests.
+func (g *Group) Post(pattern string, h Handler) *Route {
+	return g.Handle(pattern, MethodsPost(), h)
+}
+
+// Put handles the given pattern with the given handler for PUT requests.
+func (g *Group) Put(pattern string, h Handler) *Route {
+	return g.Handle(pattern, MethodsPut(), h)
+}
+
+// Delete handles the given pattern with the given handler for DELETE requests.
+func (g *Group) Delete(pattern string, h Handler) *Route {
+	return g.Handle(pattern, MethodsDelete(), h)
+}
+
+// All handles the given pattern with the given handler for any/all methods.
+func (g *Group) All(pattern string, h Handler) *Route {
+	return g.Handle(pattern, MethodsAll(), h)
+}
+
+// DefaultFunc is the same as Default but takes a HandlerFunc.
+func (g *Group) DefaultFunc(methods Methods, f HandlerFunc) {
+	g.Default(methods, f)
+}
+
+// HandleFunc is the same as Handle but takes a HandlerFunc.
+func (g *Group) HandleFunc(pattern string, methods Methods, f HandlerFunc) *Route {
+	return g.Handle(pattern, methods, f)
+}
+
+// GetFunc is the same as Get but takes a HandlerFunc.
+func (g *Group) GetFunc(pattern string, f HandlerFunc) *Route {
+	return g.HandleFunc(pattern, MethodsGet(), f)
+}
+
+// PostFunc is the same as Post but takes a HandlerFunc.
+func (g *Group) PostFunc(pattern string, f HandlerFunc) *Route {
+	return g.HandleFunc(pattern, MethodsPost(), f)
+}
+
+// PutFunc is the same as Put but takes a HandlerFunc.
+func (g *Group) PutFunc(pattern string, f HandlerFunc) *Route {
+	return g.HandleFunc(pattern, MethodsPut(), f)
+}
+
+// DeleteFunc is the same as Delete but takes a HandlerFunc.
+func (g *Group) DeleteFunc(pattern string, f HandlerFunc) *Route {
+	return g.HandleFunc(pattern, MethodsDelete(), f)
+}
+
+// AllFunc is the same as All but takes a HandlerFunc.
+func (g *Group) AllFunc(pattern string, f HandlerFunc) *Route {
+	return g.HandleFunc(pattern, MethodsAll(), f)
+}
+
+// joinPattern joins the prefix and pattern, making sure there is exactly one
+// slash between them. The result always starts with a slash.
+func joinPattern(prefix, pattern string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if pattern == "" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	if pattern[0] != '/' {
+		pattern = "/" + pattern
+	}
+	return prefix + pattern
+}
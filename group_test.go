@@ -0,0 +1,144 @@
+package jmux
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	router := NewRouter()
+	router.Group("/api/v2", func(g *Group) {
+		g.GetFunc("", func(c *Context) {
+			c.WriteString("api")
+		})
+		g.GetFunc("/users/{id}", func(c *Context) {
+			c.WriteString("user=" + c.Params["id"])
+		})
+		g.Group("/admin", func(g *Group) {
+			g.PostFunc("/reset", func(c *Context) {
+				c.WriteString("reset")
+			})
+		})
+		g.DefaultFunc(MethodsAll(), func(c *Context) {
+			c.WriteError(http.StatusNotFound, "api not found")
+		})
+	})
+
+	tests := []struct {
+		method, path, want string
+		code               int
+	}{
+		{http.MethodGet, "/api/v2", "api", http.StatusOK},
+		{http.MethodGet, "/api/v2/users/1", "user=1", http.StatusOK},
+		{http.MethodPost, "/api/v2/admin/reset", "reset", http.StatusOK},
+		{http.MethodGet, "/api/v2/other", "api not found\n", http.StatusNotFound},
+		{http.MethodGet, "/other", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, test.method, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.want {
+			t.Fatalf(`%s: expected "%s", got "%s"`, test.path, test.want, got)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	sub := NewRouter()
+	sub.GetFunc("/", func(c *Context) {
+		c.WriteString("tenant=" + c.Params["tenant"] + " root")
+	})
+	sub.GetFunc("/users/{id}", func(c *Context) {
+		c.WriteString(
+			"tenant=" + c.Params["tenant"] + " user=" + c.Params["id"] +
+				" path=" + c.Path(),
+		)
+	})
+	sub.NotFoundFunc(func(c *Context) {
+		c.WriteError(http.StatusNotFound, "sub not found")
+	})
+
+	router := NewRouter()
+	router.Mount("/tenants/{tenant}", sub)
+	router.GetFunc("/tenants", func(c *Context) {
+		c.WriteString("tenants")
+	})
+
+	tests := []struct {
+		path, want string
+		code       int
+	}{
+		{"/tenants", "tenants", http.StatusOK},
+		{"/tenants/acme", "tenant=acme root", http.StatusOK},
+		{"/tenants/acme/", "tenant=acme root", http.StatusOK},
+		{
+			"/tenants/acme/users/1",
+			"tenant=acme user=1 path=/tenants/acme/users/1",
+			http.StatusOK,
+		},
+		{"/tenants/acme/other", "sub not found\n", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.want {
+			t.Fatalf(`%s: expected "%s", got "%s"`, test.path, test.want, got)
+		}
+	}
+
+	// The catch-all used to mount the router is internal.
+	for _, info := range router.Routes() {
+		if strings.Contains(info.Pattern, mountParam) {
+			t.Fatalf("expected mount catch-all to be hidden, got:\n%s", router.Routes())
+		}
+	}
+	// A catch-all under the mount's prefix would take its requests (or have
+	// its requests taken), in either mode.
+	for _, strict := range []bool{false, true} {
+		router := NewRouter(WithStrict(strict))
+		router.Mount("/api/{ver}", sub)
+		_, err := router.TryHandle("/api/{ver}/{rest...}", MethodsGet(), nil)
+		var re *RouteError
+		if !errors.As(err, &re) || !errors.Is(err, ErrAmbiguousPattern) ||
+			re.Conflict != "/api/{ver}" {
+			t.Fatalf("expected conflict with mount, got %v", err)
+		}
+		func() {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, ErrAmbiguousPattern) {
+					t.Fatalf("expected ambiguous pattern panic, got %v", err)
+				}
+			}()
+			router.Get("/api/{ver}/{rest...}", sub)
+		}()
+
+		router.Get("/files/{rest...}", sub)
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.As(err, &re) || re.Pattern != "/files" ||
+					re.Conflict != "/files/{rest...}" {
+					t.Fatalf("expected mount conflict panic, got %v", err)
+				}
+			}()
+			router.Mount("/files", sub)
+		}()
+	}
+
+	// A router used directly as a handler routes the full path but keeps the
+	// params.
+	router.Get("/orgs/{tenant}/{rest...}", sub)
+	sub.GetFunc("/orgs/{org}/users/{id}", func(c *Context) {
+		c.WriteString("tenant=" + c.Params["tenant"] + " org=" + c.Params["org"])
+	})
+	rec := serveRecorder(router, http.MethodGet, "/orgs/acme/users/1")
+	if got, want := rec.Body.String(), "tenant=acme org=acme"; got != want {
+		t.Fatalf(`expected "%s", got "%s"`, want, got)
+	}
+}
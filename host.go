@@ -0,0 +1,201 @@
+package jmux
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// hostRoute is a router used for requests whose host matches a pattern.
+type hostRoute struct {
+	pattern string
+	// The labels of the pattern (without the wildcard), with literal text
+	// lowercased
+	labels []segment
+	// Whether the pattern starts with a wildcard ("*") label
+	wildcard bool
+	// The port required by the pattern, if any
+	port   string
+	router *Router
+}
+
+// Host returns the router used for requests whose host matches the given
+// pattern, creating it if necessary. The new router has the same options
+// (including recovery), constraints, and error handler (see
+// Router.ErrorHandler) as the calling router, but not its routes, middleware,
+// or fallback handlers, which must be set on the host router. Changes made to
+// the calling router's error handler afterwards aren't inherited. The host
+// router uses the calling router's validation rules (see Router.Rule) for
+// names it has no rules of its own for.
+//
+// The pattern is a host name made of dot-separated labels, which may be
+// parameters in the same form as slugs in a path pattern (e.g.,
+// "{tenant}.example.com" or "{tenant:alpha}-app.example.com"). Matched host
+// params are added to the Context's Params, with params matched in the path
+// taking precedence. A pattern may start with a wildcard label ("*"), which
+// matches one or more labels (e.g., "*.example.com" matches "a.example.com"
+// and "a.b.example.com", but not "example.com"). Hosts are matched without
+// regard to case.
+//
+// A pattern with a port (e.g., "example.com:8080") only matches requests for
+// that port, while a pattern without one matches requests for any port.
+//
+// Exact hosts are tried first, then those with parameters, then those with
+// wildcards (with longer patterns first). Requests whose host doesn't match
+// any pattern are routed by the calling router as usual. Panics if the
+// pattern is malformed.
+func (router *Router) Host(pattern string) *Router {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	for _, hr := range router.hosts {
+		if hr.pattern == pattern {
+			return hr.router
+		}
+	}
+	hr, err := parseHost(router, pattern)
+	if err != nil {
+		panic(fmt.Sprintf("jmux: host %q: %v", pattern, err))
+	}
+	hr.router = NewRouter(
+		WithAutoOptions(router.autoOptions),
+		WithAutoHead(router.autoHead),
+		WithStrict(router.strict),
+		WithRedirect(router.redirect),
+		WithCaseMode(router.caseMode),
+		WithEscapedPath(router.escapedPath),
+		WithFallbackMiddleware(router.fallbackMiddleware),
+		WithErrorRenderer(router.errorRenderer),
+	)
+	hr.router.constraints = cloneConstraints(router.constraints)
+	hr.router.ruleParent = router
+	hr.router.panicHook = router.panicHook
+	hr.router.errorHandler = router.errorHandler
+	router.hosts = append(router.hosts, hr)
+	sort.SliceStable(router.hosts, func(i, j int) bool {
+		a, b := router.hosts[i], router.hosts[j]
+		if ra, rb := a.rank(), b.rank(); ra != rb {
+			return ra < rb
+		}
+		return len(a.labels) > len(b.labels)
+	})
+	router.markDirty()
+	return hr.router
+}
+
+// parseHost parses the host pattern.
+func parseHost(router *Router, pattern string) (*hostRoute, error) {
+	host, port := splitHostPort(pattern)
+	if host == "" {
+		return nil, errors.New("empty host")
+	}
+	hr := &hostRoute{pattern: pattern, port: port}
+	if strings.HasPrefix(host, "*.") {
+		host, hr.wildcard = host[2:], true
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" {
+			return nil, errors.New("empty label")
+		} else if label == "*" {
+			return nil, errors.New("wildcard must be the first label")
+		}
+		parts, err := parseSlug(router, label)
+		if err != nil {
+			return nil, fmt.Errorf("label %q: %w", label, err)
+		}
+		for i := range parts {
+			parts[i].literal = strings.ToLower(parts[i].literal)
+		}
+		seg := segment{name: strings.ToLower(label), pattern: label}
+		if len(parts) == 1 && parts[0].param {
+			part := parts[0]
+			if part.catchAll {
+				return nil, fmt.Errorf("label %q: catch-all parameters not allowed", label)
+			}
+			seg.name, seg.param, seg.constraint = part.name, true, part.constraint
+		} else if len(parts) > 1 {
+			seg.param, seg.parts = true, parts
+		}
+		hr.labels = append(hr.labels, seg)
+	}
+	return hr, nil
+}
+
+// rank returns the precedence of the host route, with lower ranks being
+// tried first.
+func (hr *hostRoute) rank() int {
+	if hr.wildcard {
+		return 2
+	}
+	for _, label := range hr.labels {
+		if label.param {
+			return 1
+		}
+	}
+	return 0
+}
+
+// match matches the host route against the host (lowercased, without a port)
+// and port. The matched params are appended to params.
+func (hr *hostRoute) match(host, port string, params *[]pathParam) bool {
+	if hr.port != "" && hr.port != port {
+		return false
+	}
+	// Match the labels from the end so that a wildcard takes the remainder.
+	labels := strings.Split(host, ".")
+	extra := len(labels) - len(hr.labels)
+	if extra < 0 || (extra == 0) == hr.wildcard {
+		return false
+	}
+	// Empty labels (e.g., in ".example.com") match neither params nor
+	// wildcards, the same way empty slugs don't match path params.
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	l := len(*params)
+	for i, seg := range hr.labels {
+		label := labels[extra+i]
+		if !seg.param {
+			if label != seg.name {
+				*params = (*params)[:l]
+				return false
+			}
+		} else if _, ok := seg.matchSlug(label, "", label, params); !ok {
+			*params = (*params)[:l]
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost returns the host router for the request's host, if any. The
+// matched host params are appended to params.
+func (s *snapshot) matchHost(host string, params *[]pathParam) *Router {
+	if len(s.hosts) == 0 {
+		return nil
+	}
+	host, port := splitHostPort(strings.ToLower(host))
+	host = strings.TrimSuffix(host, ".")
+	for _, hr := range s.hosts {
+		if hr.match(host, port, params) {
+			return hr.router
+		}
+	}
+	return nil
+}
+
+// splitHostPort splits the host into the host name and port, either of which
+// may be empty. Brackets around IPv6 addresses are kept.
+func splitHostPort(host string) (string, string) {
+	i := strings.LastIndexByte(host, ':')
+	if i == -1 || strings.IndexByte(host[i:], ']') != -1 {
+		return host, ""
+	}
+	if host[0] != '[' && strings.Count(host, ":") > 1 {
+		// An IPv6 address without brackets or a port.
+		return host, ""
+	}
+	return host[:i], host[i+1:]
+}
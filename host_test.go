@@ -0,0 +1,101 @@
+package jmux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/", func(c *Context) {
+		c.WriteString("default")
+	})
+	router.Host("api.example.com").GetFunc("/users/{id}", func(c *Context) {
+		c.WriteString("api user=" + c.Params["id"])
+	})
+	router.Host("admin.example.com:8443").GetFunc("/", func(c *Context) {
+		c.WriteString("admin")
+	})
+	router.Host("{tenant}.example.com").GetFunc("/", func(c *Context) {
+		c.WriteString("tenant=" + c.Params["tenant"])
+	})
+	router.Host("{tenant}.example.com").GetFunc("/{tenant}", func(c *Context) {
+		c.WriteString("path tenant=" + c.Params["tenant"])
+	})
+	router.Host("{region:alpha}-{zone:int}.cdn.example.com").GetFunc("/", func(c *Context) {
+		c.WriteString("region=" + c.Params["region"] + " zone=" + c.Params["zone"])
+	})
+	router.Host("*.example.com").GetFunc("/", func(c *Context) {
+		c.WriteString("wildcard")
+	})
+	router.Host("*.static.example.com").GetFunc("/", func(c *Context) {
+		c.WriteString("static wildcard")
+	})
+
+	tests := []struct {
+		target, want string
+		code         int
+	}{
+		{"http://api.example.com/users/1", "api user=1", http.StatusOK},
+		{"http://API.Example.com:8080/users/1", "api user=1", http.StatusOK},
+		{"http://api.example.com./users/1", "api user=1", http.StatusOK},
+		// Host routers don't fall back to the default routes.
+		{"http://api.example.com/", "", http.StatusNotFound},
+		{"http://admin.example.com:8443/", "admin", http.StatusOK},
+		{"http://admin.example.com/", "tenant=admin", http.StatusOK},
+		{"http://acme.example.com/", "tenant=acme", http.StatusOK},
+		{"http://acme.example.com/other", "path tenant=other", http.StatusOK},
+		{"http://eu-1.cdn.example.com/", "region=eu zone=1", http.StatusOK},
+		{"http://eu-x.cdn.example.com/", "wildcard", http.StatusOK},
+		{"http://a.b.example.com/", "wildcard", http.StatusOK},
+		{"http://a.b.static.example.com/", "static wildcard", http.StatusOK},
+		{"http://.example.com/", "default", http.StatusOK},
+		{"http://.b.example.com/", "default", http.StatusOK},
+		{"http://example.com/", "default", http.StatusOK},
+		{"http://other.com/", "default", http.StatusOK},
+		{"http://[::1]:8080/", "default", http.StatusOK},
+		{"/", "default", http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.target)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.target, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s: expected %q, got %q", test.target, test.want, body)
+		}
+	}
+
+	if router.Host("api.example.com") != router.Host("api.example.com") {
+		t.Fatal("expected the same router for the same host pattern")
+	}
+	for _, pattern := range []string{"", "a..com", "a.*.com", "{host...}.com", "{a"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%q: expected panic", pattern)
+				}
+			}()
+			router.Host(pattern)
+		}()
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		in, host, port string
+	}{
+		{"example.com", "example.com", ""},
+		{"example.com:8080", "example.com", "8080"},
+		{"[::1]", "[::1]", ""},
+		{"[::1]:8080", "[::1]", "8080"},
+		{"::1", "::1", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		host, port := splitHostPort(test.in)
+		if host != test.host || port != test.port {
+			t.Fatalf("%q: expected %q, %q, got %q, %q", test.in, test.host, test.port, host, port)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package jmux
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Matcher reports whether a request is accepted by a handler, in addition to
+// its path and method.
+type Matcher func(*http.Request) bool
+
+// variant is a handler registered on a route that is only used for requests
+// accepted by all of its matchers.
+type variant struct {
+	methods  Methods
+	handler  Handler
+	matchers []Matcher
+	// The trailing optional parameters of the pattern the handler was
+	// registered with, if any
+	optional []segment
+	// The handlers (and their optional parameters) replaced by the
+	// registration of the handler, which are restored once the handler is
+	// given matchers
+	replaced         map[string]Handler
+	replacedOptional map[string][]segment
+}
+
+// match returns whether the request is accepted by all of the matchers.
+func (v *variant) match(r *http.Request) bool {
+	for _, m := range v.matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Headers adds a matcher to the handler most recently registered on the route
+// which only accepts requests with the given headers (see MatchHeaders).
+//
+// Handlers with matchers are only used for requests accepted by all of their
+// matchers, and are tried in the order they were registered, before the
+// route's handlers without matchers. If none of the route's handlers accept a
+// request, matching continues as if the route didn't exist, falling back to
+// the HandleAny handlers of the route and its parents, then the Default
+// handlers, then the NotFound handler.
+//
+// Until the first matcher is added, the handler is used for every request,
+// replacing any handler without matchers registered for the same methods
+// (which is restored once the matcher is added), and in strict mode (see
+// WithStrict), registering it panics if there is such a handler. Use
+// Router.HandleMatch to register a handler along with its matchers.
+// Returns the calling route.
+func (route *Route) Headers(pairs ...string) *Route {
+	return route.addMatcher(MatchHeaders(pairs...))
+}
+
+// Queries adds a matcher to the handler most recently registered on the route
+// which only accepts requests with the given query values (see
+// MatchQueries). See Route.Headers.
+// Returns the calling route.
+func (route *Route) Queries(pairs ...string) *Route {
+	return route.addMatcher(MatchQueries(pairs...))
+}
+
+// Schemes adds a matcher to the handler most recently registered on the route
+// which only accepts requests with one of the given schemes (see
+// MatchSchemes). See Route.Headers.
+// Returns the calling route.
+func (route *Route) Schemes(schemes ...string) *Route {
+	return route.addMatcher(MatchSchemes(schemes...))
+}
+
+// MatchHeaders returns a matcher which only accepts requests with the given
+// headers, given as key/value pairs (e.g., MatchHeaders("X-Api-Version",
+// "2")). A request has a header if any of its values for the key is equal to
+// the value, or, if the value is empty, if the request has the key at all.
+// Panics if there is an odd number of arguments.
+func MatchHeaders(pairs ...string) Matcher {
+	if len(pairs)%2 != 0 {
+		panic("jmux: odd number of header key/value pairs")
+	}
+	return func(r *http.Request) bool {
+		for i := 0; i < len(pairs); i += 2 {
+			if !hasValue(r.Header.Values(pairs[i]), pairs[i+1]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchQueries returns a matcher which only accepts requests with the given
+// query values, given as key/value pairs (e.g., MatchQueries("format",
+// "json")). A request has a query value if any of its values for the key is
+// equal to the value, or, if the value is empty, if the request's query has
+// the key at all. Panics if there is an odd number of arguments.
+func MatchQueries(pairs ...string) Matcher {
+	if len(pairs)%2 != 0 {
+		panic("jmux: odd number of query key/value pairs")
+	}
+	return func(r *http.Request) bool {
+		query := r.URL.Query()
+		for i := 0; i < len(pairs); i += 2 {
+			if !hasValue(query[pairs[i]], pairs[i+1]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchSchemes returns a matcher which only accepts requests with one of the
+// given schemes (e.g., "https"), compared without regard to case. The scheme
+// of a request is that of its URL if set, otherwise it is "https" for
+// requests received over TLS and "http" for all others.
+func MatchSchemes(schemes ...string) Matcher {
+	return func(r *http.Request) bool {
+		scheme := requestScheme(r)
+		for _, s := range schemes {
+			if strings.EqualFold(s, scheme) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HandleMatch handles the given pattern, allowing the given methods, using
+// the given handler only for requests accepted by all of the matchers (see
+// Route.Headers). The handler is registered along with its matchers, so,
+// unlike adding matchers to a handler registered with Handle, it never
+// replaces the route's handler without matchers, and in strict mode (see
+// WithStrict), it doesn't conflict with it (or with other handlers with
+// matchers). With no matchers, this is the same as Handle. See Router.Handle.
+func (router *Router) HandleMatch(
+	pattern string, methods Methods, h Handler, matchers ...Matcher,
+) *Route {
+	if pattern == "" {
+		return nil
+	}
+	return router.getMatchRoute(pattern, methods, h, matchers)
+}
+
+// HandleMatch handles the given pattern, appended to the group's prefix,
+// using the given handler only for requests accepted by all of the matchers.
+// See Router.HandleMatch.
+func (g *Group) HandleMatch(
+	pattern string, methods Methods, h Handler, matchers ...Matcher,
+) *Route {
+	return g.router.getMatchRoute(joinPattern(g.prefix, pattern), methods, g.wrap(h), matchers)
+}
+
+// MatcherFunc adds the matcher to the handler most recently registered on the
+// route. See Route.Headers.
+// Returns the calling route.
+func (route *Route) MatcherFunc(m Matcher) *Route {
+	return route.addMatcher(m)
+}
+
+// addMatcher adds the matcher to the handler most recently registered on the
+// route, making it a variant if it isn't one already. Panics if no handler has
+// been registered on the route.
+func (route *Route) addMatcher(m Matcher) *Route {
+	route.router.mtx.Lock()
+	defer route.router.mtx.Unlock()
+	v := route.last
+	if v == nil {
+		panic("jmux: matcher added to a route without a handler")
+	}
+	if len(v.matchers) == 0 {
+		for method := range v.methods {
+			if h, ok := v.replaced[method]; ok {
+				route.handlers[method] = h
+			} else {
+				delete(route.handlers, method)
+			}
+			route.setOptional(method, v.replacedOptional[method])
+		}
+		v.replaced, v.replacedOptional = nil, nil
+		route.variants = append(route.variants, v)
+	}
+	v.matchers = append(v.matchers, m)
+	route.compose()
+	return route
+}
+
+// removeVariants removes the given methods from the route's variants,
+// dropping variants left without methods. Returns whether any were removed.
+func (route *Route) removeVariants(methods Methods) bool {
+	removed := false
+	variants := route.variants[:0]
+	for _, v := range route.variants {
+		for method := range methods {
+			if v.methods.Has(method) {
+				v.methods.Unset(method)
+				removed = true
+			}
+		}
+		if len(v.methods) != 0 {
+			variants = append(variants, v)
+		}
+	}
+	route.variants = variants
+	return removed
+}
+
+// hasValue returns whether the values contain the value, or, if the value is
+// empty, whether there are any values.
+func hasValue(values []string, value string) bool {
+	if value == "" {
+		return len(values) != 0
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// requestScheme returns the scheme of the request.
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
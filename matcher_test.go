@@ -0,0 +1,159 @@
+package jmux
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	write := func(s string) HandlerFunc {
+		return func(c *Context) {
+			c.WriteString(s)
+		}
+	}
+	router := NewRouter()
+	router.Get("/items", write("html"))
+	router.Get("/items", write("json")).Headers("Accept", "application/json")
+	router.Get("/items", write("v2")).
+		Headers("X-Api-Version", "2").
+		Queries("debug", "")
+	router.Post("/items", write("post"))
+	router.Get("/secure", write("secure")).Schemes("https")
+	router.Get("/secure", write("custom")).MatcherFunc(func(r *http.Request) bool {
+		return strings.HasPrefix(r.UserAgent(), "custom")
+	})
+	router.Get("/api/v1/{name}", write("name")).Queries("format", "json")
+	router.Group("/api", nil).Default(MethodsAll(), write("api"))
+	router.Get("/only", write("only")).Headers("X-Only", "1")
+	router.Post("/only", write("only post"))
+	router.DefaultFunc(MethodsAll(), write("default"))
+
+	tests := []struct {
+		target  string
+		headers []string
+		tls     bool
+		want    string
+		code    int
+	}{
+		{"/items", nil, false, "html", http.StatusOK},
+		{"/items", []string{"Accept", "application/json"}, false, "json", http.StatusOK},
+		{"/items?debug", []string{"X-Api-Version", "2"}, false, "v2", http.StatusOK},
+		{"/items", []string{"X-Api-Version", "2"}, false, "html", http.StatusOK},
+		{"/secure", nil, true, "secure", http.StatusOK},
+		{"https://example.com/secure", nil, false, "secure", http.StatusOK},
+		{"/secure", []string{"User-Agent", "custom/1.0"}, false, "custom", http.StatusOK},
+		// Rejected requests fall back to HandleAny parents, then defaults.
+		{"/secure", nil, false, "default", http.StatusOK},
+		{"/api/v1/a?format=json", nil, false, "name", http.StatusOK},
+		{"/api/v1/a?format=xml", nil, false, "api", http.StatusOK},
+		{"/only", nil, false, "default", http.StatusOK},
+		{"/only", []string{"X-Only", "1"}, false, "only", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		for i := 0; i < len(test.headers); i += 2 {
+			r.Header.Set(test.headers[i], test.headers[i+1])
+		}
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Fatalf("%s %v: expected %d, got %d", test.target, test.headers, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s %v: expected %q, got %q", test.target, test.headers, test.want, body)
+		}
+	}
+
+	rec := serveRecorder(router, http.MethodOptions, "/only")
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Fatalf("expected conditional methods to be allowed, got %q", allow)
+	}
+	if rec := serveRecorder(router, http.MethodPost, "/items"); rec.Body.String() != "post" {
+		t.Fatalf("expected post, got %q", rec.Body.String())
+	}
+
+	if !router.Remove("/only", MethodsGet()) {
+		t.Fatal("expected conditional handler to be removed")
+	}
+	if rec := serveRecorder(router, http.MethodGet, "/only"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for matcher without a handler")
+			}
+		}()
+		router.Group("/nothing", nil).Route().Headers("X", "1")
+	}()
+}
+
+func TestHandleMatch(t *testing.T) {
+	write := func(s string) HandlerFunc {
+		return func(c *Context) {
+			c.WriteString(s)
+		}
+	}
+	router := NewRouter(WithStrict(true))
+	router.Get("/items", write("html"))
+	router.HandleMatch("/items", MethodsGet(), write("json"), MatchHeaders("Accept", "application/json"))
+	router.HandleMatch(
+		"/items", MethodsGet(), write("v2"),
+		MatchHeaders("X-Api-Version", "2"), MatchQueries("debug", ""),
+	)
+	router.Group("/secure", nil).HandleMatch("", MethodsGet(), write("secure"), MatchSchemes("https"))
+	router.HandleMatch("/plain", MethodsGet(), write("plain"))
+
+	tests := []struct {
+		target  string
+		headers []string
+		want    string
+		code    int
+	}{
+		{"/items", nil, "html", http.StatusOK},
+		{"/items", []string{"Accept", "application/json"}, "json", http.StatusOK},
+		{"/items?debug", []string{"X-Api-Version", "2"}, "v2", http.StatusOK},
+		{"/items", []string{"X-Api-Version", "2"}, "html", http.StatusOK},
+		{"https://example.com/secure", nil, "secure", http.StatusOK},
+		{"/secure", nil, "", http.StatusNotFound},
+		{"/plain", nil, "plain", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		for i := 0; i < len(test.headers); i += 2 {
+			r.Header.Set(test.headers[i], test.headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Fatalf("%s %v: expected %d, got %d", test.target, test.headers, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s %v: expected %q, got %q", test.target, test.headers, test.want, body)
+		}
+	}
+
+	// Handlers without matchers still conflict in strict mode, including those
+	// registered with HandleMatch without matchers.
+	for _, pattern := range []string{"/items", "/plain"} {
+		if _, err := router.TryHandle(pattern, MethodsGet(), write("other")); !errors.Is(err, ErrDuplicateHandler) {
+			t.Fatalf("%s: expected duplicate handler error, got %v", pattern, err)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for odd number of pairs")
+			}
+		}()
+		MatchHeaders("X")
+	}()
+}
@@ -0,0 +1,250 @@
+package jmux
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextCtxKeyType struct{}
+
+// contextCtxKey is the key used to store the jmux Context in an
+// http.Request's context while it passes through standard middleware.
+var contextCtxKey contextCtxKeyType
+
+// Middleware wraps a handler, returning the handler to be used in its place.
+//
+// Middleware can be added at the router level (Router.Use), the group level
+// (Group.Use), and the route level (Route.Use). Router middleware is the
+// outermost (called first), followed by group middleware (that of outer groups
+// first), followed by route middleware, followed by the handler itself.
+// Middleware added at the same level is called in the order it was added.
+// Middleware applies to the handlers it covers whether they were registered
+// before or after it was added.
+type Middleware func(Handler) Handler
+
+// WrapMiddleware wraps standard middleware as jmux Middleware. Any changes
+// the middleware makes to the request or response writer are reflected in the
+// Context passed to the next handler. As with WrapH, the params are available
+// through the request's context using ParamsKey.
+func WrapMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(next Handler) Handler {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, _ := r.Context().Value(contextCtxKey).(*Context)
+			if c == nil {
+				params, _ := r.Context().Value(ParamsKey).(map[string]string)
+				if params == nil {
+					params = make(map[string]string)
+				}
+				c = newContext(w, r, params)
+			}
+			c.Writer, c.Request = w, r
+			next.ServeC(c)
+		}))
+		return HandlerFunc(func(c *Context) {
+			ctx := context.WithValue(c.Request.Context(), contextCtxKey, c)
+			ctx = context.WithValue(ctx, ParamsKey, c.Params)
+			h.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+		})
+	}
+}
+
+// Fallback is a set of fallback handlers.
+type Fallback uint8
+
+const (
+	// FallbackHandleAny is for handlers set with Route.HandleAny.
+	FallbackHandleAny Fallback = 1 << iota
+	// FallbackDefault is for handlers set with Router.Default.
+	FallbackDefault
+	// FallbackNotFound is for the handler set with Router.NotFound.
+	FallbackNotFound
+	// FallbackMethodNotAllowed is for the handler set with
+	// Router.MethodNotAllowed.
+	FallbackMethodNotAllowed
+	// FallbackAll is for all fallback handlers.
+	FallbackAll = FallbackHandleAny | FallbackDefault | FallbackNotFound |
+		FallbackMethodNotAllowed
+)
+
+// WithFallbackMiddleware sets the fallback handlers the router's middleware
+// (added with Router.Use) is applied to. By default, router middleware is only
+// applied to handlers of matched routes. Route middleware is always applied to
+// the route's HandleAny handlers.
+func WithFallbackMiddleware(fallbacks Fallback) RouterOption {
+	return func(router *Router) {
+		router.fallbackMiddleware = fallbacks
+	}
+}
+
+// Use adds middleware to the router. See Middleware for the order in which
+// middleware is called.
+func (router *Router) Use(mws ...Middleware) *Router {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	router.middleware = append(router.middleware, mws...)
+	router.base.composeAll()
+	router.composeFallbacks()
+	return router
+}
+
+// Use adds middleware to the route, which applies to the route's handlers and
+// HandleAny handlers (but not those of child routes). See Middleware for the
+// order in which middleware is called. While the router is serving requests,
+// a request may be served by a newly registered handler before the
+// middleware is added, unless both are done in Router.Batch.
+// Returns the calling route.
+func (route *Route) Use(mws ...Middleware) *Route {
+	route.router.mtx.Lock()
+	defer route.router.mtx.Unlock()
+	route.middleware = append(route.middleware, mws...)
+	route.compose()
+	return route
+}
+
+// Use adds middleware to the group, which applies to handlers registered
+// through the group (or groups nested within it), including its default
+// handlers and mounted routers. See Middleware for the order in which
+// middleware is called. While the router is serving requests, a request may
+// be served by a newly registered handler before the middleware is added,
+// unless both are done in Router.Batch.
+// Returns the calling group.
+func (g *Group) Use(mws ...Middleware) *Group {
+	g.router.mtx.Lock()
+	defer g.router.mtx.Unlock()
+	g.middleware = append(g.middleware, mws...)
+	g.router.base.composeAll()
+	return g
+}
+
+// allMiddleware returns the middleware of the group's outer groups, followed
+// by the group's own. Must be called with the router's lock held.
+func (g *Group) allMiddleware() []Middleware {
+	if g.parent == nil {
+		return g.middleware
+	}
+	outer := g.parent.allMiddleware()
+	return append(outer[:len(outer):len(outer)], g.middleware...)
+}
+
+// wrap marks the handler as registered through the group, so that routes
+// wrap it with the group's middleware (see Route.wrapHandler).
+func (g *Group) wrap(h Handler) Handler {
+	if h == nil {
+		return nil
+	}
+	return groupHandler{handler: h, group: g}
+}
+
+// groupHandler is a handler registered through a group. Routes wrap the
+// handler with the group's middleware when composing their handlers.
+type groupHandler struct {
+	handler Handler
+	group   *Group
+}
+
+// ServeC serves the request using the unwrapped handler. Routes never serve
+// groupHandlers directly, as they're unwrapped when composed.
+func (h groupHandler) ServeC(c *Context) {
+	h.handler.ServeC(c)
+}
+
+// wrapHandler wraps the handler with the route's middleware, then, if it was
+// registered through a group, with the group's middleware.
+func (route *Route) wrapHandler(h Handler) Handler {
+	gh, ok := h.(groupHandler)
+	if !ok {
+		return wrapMiddleware(h, route.middleware)
+	}
+	h = wrapMiddleware(gh.handler, route.middleware)
+	return wrapMiddleware(h, gh.group.allMiddleware())
+}
+
+// compose wraps the route's handlers (including those with matchers) with the
+// route and router middleware.
+func (route *Route) compose() {
+	router := route.router
+	router.markDirty()
+	route.composed = make(map[string]Handler, len(route.handlers))
+	for method, h := range route.handlers {
+		if h != nil {
+			h = wrapMiddleware(route.wrapHandler(h), router.middleware)
+		}
+		route.composed[method] = h
+	}
+	route.composedVariants = make([]variant, len(route.variants))
+	for i, v := range route.variants {
+		h := v.handler
+		if h != nil {
+			h = wrapMiddleware(route.wrapHandler(h), router.middleware)
+		}
+		route.composedVariants[i] = variant{
+			methods:  CloneMethods(v.methods),
+			handler:  h,
+			matchers: append([]Matcher(nil), v.matchers...),
+			optional: v.optional,
+		}
+	}
+	route.composedDefaults = make(map[string]Handler, len(route.defaults))
+	for method, h := range route.defaults {
+		if h != nil {
+			h = router.wrapFallback(route.wrapHandler(h), FallbackDefault)
+		}
+		route.composedDefaults[method] = h
+	}
+	route.composedAny = make(map[string]Handler, len(route.matchAny))
+	for method, h := range route.matchAny {
+		if h != nil {
+			h = wrapMiddleware(h, route.middleware)
+			h = router.wrapFallback(h, FallbackHandleAny)
+		}
+		route.composedAny[method] = h
+	}
+}
+
+// composeAll composes the route and all of its children.
+func (route *Route) composeAll() {
+	route.compose()
+	for _, ro := range route.routes {
+		ro.composeAll()
+	}
+	for _, ro := range route.params {
+		ro.composeAll()
+	}
+}
+
+// composeFallbacks wraps the router's fallback handlers with the router's
+// middleware, where enabled.
+func (router *Router) composeFallbacks() {
+	router.markDirty()
+	router.composedDefaults = make(map[string]Handler, len(router.defaultHandlers))
+	for method, h := range router.defaultHandlers {
+		if h != nil {
+			h = router.wrapFallback(h, FallbackDefault)
+		}
+		router.composedDefaults[method] = h
+	}
+	router.composedNotFound = router.wrapFallback(
+		router.notFoundHandler, FallbackNotFound,
+	)
+	router.composedMethodNotAllowed = router.wrapFallback(
+		router.methodNotAllowedHandler, FallbackMethodNotAllowed,
+	)
+}
+
+// wrapFallback wraps the fallback handler with the router's middleware if
+// enabled for the fallback.
+func (router *Router) wrapFallback(h Handler, fallback Fallback) Handler {
+	if router.fallbackMiddleware&fallback == 0 {
+		return h
+	}
+	return wrapMiddleware(h, router.middleware)
+}
+
+// wrapMiddleware wraps the handler with the middleware such that the first
+// middleware is the outermost.
+func wrapMiddleware(h Handler, mws []Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
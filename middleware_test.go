@@ -0,0 +1,84 @@
+package jmux
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(c *Context) {
+				calls = append(calls, name)
+				next.ServeC(c)
+			})
+		}
+	}
+
+	router := NewRouter(WithFallbackMiddleware(FallbackNotFound))
+	router.Use(record("router1"), record("router2"))
+	api := router.Group("/api", func(g *Group) {
+		g.Use(record("group1"))
+		g.GetFunc("/users", func(c *Context) {
+			calls = append(calls, "handler")
+		}).Use(record("route"))
+		g.Group("/admin", func(g *Group) {
+			g.GetFunc("", func(c *Context) {
+				calls = append(calls, "handler")
+			})
+			g.Use(record("admin"))
+		})
+	})
+	router.GetFunc("/other", func(c *Context) {
+		calls = append(calls, "handler")
+	}).HandleAnyFunc(MethodsGet(), func(c *Context) {
+		calls = append(calls, "any")
+	})
+	// Middleware added after registration still applies.
+	router.Use(record("router3"))
+	api.Use(record("group2"))
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/api/users", "router1 router2 router3 group1 group2 route handler"},
+		{"/api/admin", "router1 router2 router3 group1 group2 admin handler"},
+		{"/other", "router1 router2 router3 handler"},
+		{"/other/fallback", "any"},
+		{"/missing", "router1 router2 router3"},
+	}
+	for _, test := range tests {
+		calls = nil
+		serveRecorder(router, http.MethodGet, test.path)
+		if got := strings.Join(calls, " "); got != test.want {
+			t.Fatalf(`%s: expected "%s", got "%s"`, test.path, test.want, got)
+		}
+	}
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	std := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params, _ := r.Context().Value(ParamsKey).(map[string]string)
+			w.Header().Set("X-Id", params["id"])
+			r.Header.Set("X-Std", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	router := NewRouter()
+	router.Use(WrapMiddleware(std))
+	router.GetFunc("/users/{id}", func(c *Context) {
+		c.WriteString(c.ReqHeader().Get("X-Std") + " " + c.Params["id"])
+	})
+
+	rec := serveRecorder(router, http.MethodGet, "/users/1")
+	if got := rec.Header().Get("X-Id"); got != "1" {
+		t.Fatalf(`expected X-Id of "1", got "%s"`, got)
+	}
+	if got := rec.Body.String(); got != "yes 1" {
+		t.Fatalf(`expected "yes 1", got "%s"`, got)
+	}
+}
@@ -0,0 +1,287 @@
+package jmux
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// segment is what a route matches against a slug of a path.
+type segment struct {
+	name string
+	// The slug as it appears in the registered pattern (e.g., "{id}")
+	pattern  string
+	param    bool
+	catchAll bool
+	// Used to check the parameter's value, if not nil
+	constraint Constraint
+	// The parts of a slug mixing literal text and parameters (e.g.,
+	// "{name}.{ext}"), if not nil
+	parts []slugPart
+	// The pattern with the parameter names removed (e.g., "{:int}"), used to
+	// find equivalent parameters
+	shape string
+	// Whether the parameter is optional (e.g., "{year?}"), and its default
+	// value, if it has one
+	optional   bool
+	def        string
+	hasDefault bool
+}
+
+// matchSlug matches the parameter segment against the next slug of the path,
+// where rest is what follows the slug. The matched parameters are appended to
+// params. Returns the path remaining after the match.
+func (seg *segment) matchSlug(
+	slug, rest, path string, params *[]pathParam,
+) (string, bool) {
+	if seg.catchAll {
+		if path == "/" {
+			path = ""
+		}
+		*params = append(*params, pathParam{name: seg.name, value: path})
+		return "", true
+	}
+	if slug == "/" {
+		return "", false
+	}
+	if seg.parts != nil {
+		return rest, matchParts(seg.parts, slug, params)
+	}
+	if seg.constraint != nil && !seg.constraint(slug) {
+		return "", false
+	}
+	*params = append(*params, pathParam{name: seg.name, value: slug})
+	return rest, true
+}
+
+// rank returns the precedence of the segment when matching a slug, with
+// lower ranks being tried first.
+func (seg *segment) rank() int {
+	if !seg.param {
+		return 0
+	} else if seg.catchAll {
+		return 3
+	} else if seg.constraint != nil || seg.parts != nil {
+		return 1
+	}
+	return 2
+}
+
+// slugPart is part of a slug in a pattern, either literal text or a
+// parameter.
+type slugPart struct {
+	// The literal text, if the part isn't a parameter
+	literal string
+	param   bool
+	// The name of the parameter, if the part is a parameter
+	name       string
+	catchAll   bool
+	constraint Constraint
+	// The constraint as it appears in the pattern
+	spec string
+	// Whether the parameter is optional, and its default value, if it has one
+	optional   bool
+	def        string
+	hasDefault bool
+}
+
+// parsePattern parses the pattern (without a leading slash) into the
+// segments of its slugs. An empty pattern has no segments.
+func parsePattern(router *Router, pattern string) ([]segment, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	var segs []segment
+	names := make(map[string]bool)
+	for {
+		l := nextSlug(pattern)
+		if l == -1 {
+			l = len(pattern)
+		}
+		slug := pattern[:l]
+		if slug == "" {
+			slug = "/"
+		}
+		parts, err := parseSlug(router, slug)
+		if err != nil {
+			return nil, fmt.Errorf("slug %q: %w", slug, err)
+		}
+		seg := segment{name: slug, pattern: slug, shape: slug}
+		if len(parts) == 1 && parts[0].param {
+			part := parts[0]
+			if part.catchAll && l != len(pattern) {
+				return nil, errors.New("catch-all parameter must be the last slug")
+			}
+			seg.name, seg.param = part.name, true
+			seg.catchAll, seg.constraint = part.catchAll, part.constraint
+			if part.optional {
+				// Optional parameters share nodes with required ones.
+				seg.pattern = "{" + part.name + "}"
+				if part.spec != "" {
+					seg.pattern = "{" + part.name + ":" + part.spec + "}"
+				}
+				seg.optional, seg.def, seg.hasDefault = true, part.def, part.hasDefault
+			}
+		} else if len(parts) > 1 {
+			for _, part := range parts {
+				if part.optional {
+					return nil, fmt.Errorf(
+						"slug %q: optional parameter must be the entire slug", slug,
+					)
+				}
+			}
+			seg.param, seg.parts = true, parts
+		}
+		if len(segs) != 0 && segs[len(segs)-1].optional && !seg.optional {
+			return nil, errors.New("optional parameters must end the pattern")
+		}
+		if seg.param {
+			seg.shape = ""
+			for _, part := range parts {
+				if !part.param {
+					seg.shape += part.literal
+					continue
+				}
+				if names[part.name] {
+					return nil, fmt.Errorf("duplicate parameter name %q", part.name)
+				}
+				names[part.name] = true
+				if part.catchAll {
+					seg.shape += "{...}"
+				} else if part.constraint != nil {
+					seg.shape += "{:" + part.spec + "}"
+				} else {
+					seg.shape += "{}"
+				}
+			}
+		}
+		segs = append(segs, seg)
+		if l == len(pattern) {
+			return segs, nil
+		}
+		pattern = pattern[l+1:]
+	}
+}
+
+// parseSlug parses a slug from a pattern into its literal and parameter
+// parts. Parameters are of the form "{name}", "{name:constraint}", or
+// "{name...}", where constraint is resolved using the given router. A name
+// may be followed by "?" to make the parameter optional, optionally followed
+// by "=" and a default value (e.g., "{page?=1:int}").
+func parseSlug(router *Router, slug string) ([]slugPart, error) {
+	var parts []slugPart
+	for slug != "" {
+		start := strings.IndexAny(slug, "{}")
+		if start == -1 {
+			parts = append(parts, slugPart{literal: slug})
+			break
+		} else if slug[start] == '}' {
+			return nil, errors.New("unexpected closing brace")
+		}
+		if start != 0 {
+			parts = append(parts, slugPart{literal: slug[:start]})
+		} else if len(parts) != 0 {
+			return nil, errors.New("parameters must be separated by literal text")
+		}
+		// Find the matching brace, allowing for braces in constraints (e.g.,
+		// "{id:[0-9]{3}}").
+		end, depth := -1, 0
+		for i := start; i < len(slug) && end == -1; i++ {
+			switch slug[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end == -1 {
+			return nil, errors.New("missing closing brace")
+		}
+		part := slugPart{param: true, name: slug[start+1 : end]}
+		if strings.HasSuffix(part.name, "...") {
+			part.name = part.name[:len(part.name)-3]
+			part.catchAll = true
+		} else if i := strings.IndexByte(part.name, ':'); i != -1 {
+			part.spec = part.name[i+1:]
+			c, err := router.compileConstraint(part.spec)
+			if err != nil {
+				return nil, err
+			}
+			part.name, part.constraint = part.name[:i], c
+		}
+		if i := strings.IndexByte(part.name, '?'); i != -1 {
+			if part.catchAll {
+				return nil, errors.New("catch-all parameter can't be optional")
+			}
+			if def := part.name[i+1:]; def != "" {
+				if def[0] != '=' {
+					return nil, errors.New("unexpected text after '?'")
+				}
+				part.def, part.hasDefault = def[1:], true
+			}
+			part.name, part.optional = part.name[:i], true
+		}
+		if part.name == "" {
+			return nil, errors.New("empty parameter name")
+		}
+		if part.hasDefault && part.constraint != nil && !part.constraint(part.def) {
+			return nil, fmt.Errorf("default value %q fails constraint", part.def)
+		}
+		parts = append(parts, part)
+		slug = slug[end+1:]
+	}
+	if len(parts) > 1 {
+		for _, part := range parts {
+			if part.catchAll {
+				return nil, errors.New("catch-all parameter must be the entire slug")
+			}
+		}
+	}
+	return parts, nil
+}
+
+// matchParts matches the slug against the parts, appending the matched
+// parameters to params. Parameters match as few characters as possible
+// (at least one), backtracking if the rest of the slug fails to match, with
+// the final parameter matching whatever remains.
+func matchParts(parts []slugPart, slug string, params *[]pathParam) bool {
+	if len(parts) == 0 {
+		return slug == ""
+	}
+	part := parts[0]
+	if !part.param {
+		if !strings.HasPrefix(slug, part.literal) {
+			return false
+		}
+		return matchParts(parts[1:], slug[len(part.literal):], params)
+	}
+	if len(parts) == 1 {
+		if slug == "" || (part.constraint != nil && !part.constraint(slug)) {
+			return false
+		}
+		*params = append(*params, pathParam{name: part.name, value: slug})
+		return true
+	}
+	// Parameters are always followed by literal text.
+	next := parts[1].literal
+	for i := 1; i <= len(slug)-len(next); i++ {
+		j := strings.Index(slug[i:], next)
+		if j == -1 {
+			break
+		}
+		i += j
+		value := slug[:i]
+		if part.constraint != nil && !part.constraint(value) {
+			continue
+		}
+		l := len(*params)
+		*params = append(*params, pathParam{name: part.name, value: value})
+		if matchParts(parts[2:], slug[i+len(next):], params) {
+			return true
+		}
+		*params = (*params)[:l]
+	}
+	return false
+}
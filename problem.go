@@ -0,0 +1,231 @@
+package jmux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Problem is a problem details document (RFC 9457, formerly RFC 7807),
+// written as "application/problem+json".
+type Problem struct {
+	// Type is a URI identifying the problem type. If empty, it is treated as
+	// "about:blank", meaning the problem is described by its status code.
+	Type string
+	// Title is a short summary of the problem type.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail is an explanation specific to this occurrence of the problem.
+	Detail string
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string
+	// Extensions are additional members of the document. Members with the
+	// same names as the standard members are ignored.
+	Extensions map[string]any
+}
+
+// NewProblem creates a new problem with the given status code and detail,
+// titled with the status code's text.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error returns the problem as a string.
+func (p *Problem) Error() string {
+	title := p.Title
+	if title == "" {
+		title = http.StatusText(p.Status)
+	}
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s", p.Status, title)
+	}
+	return fmt.Sprintf("%d %s: %s", p.Status, title, p.Detail)
+}
+
+// MarshalJSON marshals the problem as a JSON object, with the extensions as
+// members of the object. Empty standard members are omitted.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for name, value := range p.Extensions {
+		m[name] = value
+	}
+	for _, member := range problemMembers {
+		delete(m, member)
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON unmarshals the problem from a JSON object, with members other
+// than the standard ones added to the extensions.
+func (p *Problem) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*p = Problem{}
+	fields := map[string]any{
+		"type":     &p.Type,
+		"title":    &p.Title,
+		"status":   &p.Status,
+		"detail":   &p.Detail,
+		"instance": &p.Instance,
+	}
+	for name, raw := range m {
+		if field, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, field); err != nil {
+				return fmt.Errorf("problem member %q: %w", name, err)
+			}
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]any)
+		}
+		p.Extensions[name] = value
+	}
+	return nil
+}
+
+// problemMembers are the names of the standard problem members.
+var problemMembers = [...]string{"type", "title", "status", "detail", "instance"}
+
+// WriteProblem writes the problem as "application/problem+json", with the
+// problem's status code (or InternalServerError (500) if it has none).
+func (c *Context) WriteProblem(p *Problem) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	c.RespHeader().Set("Content-Type", "application/problem+json")
+	c.RespHeader().Del("Content-Length")
+	c.WriteHeader(status)
+	_, err = c.Write(b)
+	return err
+}
+
+// ErrorRenderer writes the response for an error, described by the problem.
+// A router's error renderer (see WithErrorRenderer) is used for the responses
+// it writes itself (its default NotFound and MethodNotAllowed handlers, and
+// recovered panics, see WithRecovery) and by the Context's error helpers
+// (e.g., WriteError, BadRequest, and WriteRequestError). The renderer must not
+// call those helpers itself.
+type ErrorRenderer func(c *Context, p *Problem)
+
+// RenderProblem is an ErrorRenderer that writes the problem using
+// Context.WriteProblem.
+func RenderProblem(c *Context, p *Problem) {
+	c.WriteProblem(p)
+}
+
+// WithErrorRenderer sets the router's error renderer. By default, the router's
+// own error responses only have a status code, and the Context's error helpers
+// write the message as plain text.
+func WithErrorRenderer(r ErrorRenderer) RouterOption {
+	return func(router *Router) {
+		router.errorRenderer = r
+	}
+}
+
+// notFound is the default NotFound handler.
+func (router *Router) notFound(c *Context) {
+	router.renderError(c, http.StatusNotFound)
+}
+
+// methodNotAllowed is the default MethodNotAllowed handler.
+func (router *Router) methodNotAllowed(c *Context) {
+	router.renderError(c, http.StatusMethodNotAllowed)
+}
+
+// renderError writes the response for an error with the given status code
+// using the router's error renderer, or only the status code if there isn't
+// one.
+func (router *Router) renderError(c *Context, status int) {
+	if router.errorRenderer == nil {
+		c.WriteHeader(status)
+		return
+	}
+	router.errorRenderer(c, NewProblem(status, ""))
+}
+
+// writeStatusError writes the error with the given status code and message
+// using the router's error renderer, if there is one. Otherwise, the message
+// is written as plain text, or only the status code is written if the
+// message is empty.
+func (c *Context) writeStatusError(status int, msg string) {
+	if r := c.errorRenderer(); r != nil {
+		r(c, NewProblem(status, msg))
+	} else if msg != "" {
+		http.Error(c.Writer, msg, status)
+	} else {
+		c.WriteHeader(status)
+	}
+}
+
+// errorRenderer returns the error renderer of the router routing the request,
+// if any.
+func (c *Context) errorRenderer() ErrorRenderer {
+	if c.router == nil {
+		return nil
+	}
+	return c.router.errorRenderer
+}
+
+// Forbidden writes a Forbidden (403) response with the given message.
+func (c *Context) Forbidden(msg string) {
+	c.writeStatusError(http.StatusForbidden, msg)
+}
+
+// NotFound writes a NotFound (404) response with the given message.
+func (c *Context) NotFound(msg string) {
+	c.writeStatusError(http.StatusNotFound, msg)
+}
+
+// Conflict writes a Conflict (409) response with the given message.
+func (c *Context) Conflict(msg string) {
+	c.writeStatusError(http.StatusConflict, msg)
+}
+
+// UnprocessableEntity writes an UnprocessableEntity (422) response with the
+// given message.
+func (c *Context) UnprocessableEntity(msg string) {
+	c.writeStatusError(http.StatusUnprocessableEntity, msg)
+}
+
+// TooManyRequests writes a TooManyRequests (429) response with the given
+// message.
+func (c *Context) TooManyRequests(msg string) {
+	c.writeStatusError(http.StatusTooManyRequests, msg)
+}
+
+// ServiceUnavailable writes a ServiceUnavailable (503) response with the
+// given message.
+func (c *Context) ServiceUnavailable(msg string) {
+	c.writeStatusError(http.StatusServiceUnavailable, msg)
+}
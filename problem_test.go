@@ -0,0 +1,137 @@
+package jmux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProblemJSON(t *testing.T) {
+	p := &Problem{
+		Type:     "https://example.com/probs/out-of-credit",
+		Title:    "You do not have enough credit.",
+		Status:   http.StatusForbidden,
+		Detail:   "Your current balance is 30, but that costs 50.",
+		Instance: "/account/12345/msgs/abc",
+		Extensions: map[string]any{
+			"balance": 30.0,
+			"status":  "ignored",
+		},
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"balance":30,"detail":"Your current balance is 30, but that costs 50.",` +
+		`"instance":"/account/12345/msgs/abc","status":403,` +
+		`"title":"You do not have enough credit.","type":"https://example.com/probs/out-of-credit"}`
+	if string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+
+	var got Problem
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	delete(p.Extensions, "status")
+	if !reflect.DeepEqual(&got, p) {
+		t.Fatalf("expected %+v, got %+v", p, &got)
+	}
+	if err := json.Unmarshal([]byte(`{"status":"x"}`), &got); err == nil {
+		t.Fatal("expected error for invalid status")
+	}
+
+	if s := NewProblem(http.StatusNotFound, "no user").Error(); s != "404 Not Found: no user" {
+		t.Fatalf("unexpected error string %q", s)
+	}
+}
+
+func TestErrorRenderer(t *testing.T) {
+	router := NewRouter(WithErrorRenderer(RenderProblem))
+	router.GetFunc("/users/{id}", func(c *Context) {
+		switch c.Params["id"] {
+		case "forbidden":
+			c.Forbidden("no access")
+		case "conflict":
+			c.Conflict("")
+		case "busy":
+			c.ServiceUnavailable("try later")
+		default:
+			c.NotFound("no user " + c.Params["id"])
+		}
+	})
+	router.Host("api.example.com").GetFunc("/", func(c *Context) {
+		c.TooManyRequests("slow down")
+	})
+
+	tests := []struct {
+		method, target string
+		code           int
+		want           string
+	}{
+		{http.MethodGet, "/users/forbidden", http.StatusForbidden,
+			`{"detail":"no access","status":403,"title":"Forbidden"}`},
+		{http.MethodGet, "/users/conflict", http.StatusConflict,
+			`{"status":409,"title":"Conflict"}`},
+		{http.MethodGet, "/users/busy", http.StatusServiceUnavailable,
+			`{"detail":"try later","status":503,"title":"Service Unavailable"}`},
+		{http.MethodGet, "/users/1", http.StatusNotFound,
+			`{"detail":"no user 1","status":404,"title":"Not Found"}`},
+		{http.MethodGet, "/missing", http.StatusNotFound,
+			`{"status":404,"title":"Not Found"}`},
+		{http.MethodPost, "/users/1", http.StatusMethodNotAllowed,
+			`{"status":405,"title":"Method Not Allowed"}`},
+		{http.MethodGet, "http://api.example.com/", http.StatusTooManyRequests,
+			`{"detail":"slow down","status":429,"title":"Too Many Requests"}`},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, test.method, test.target)
+		if rec.Code != test.code {
+			t.Fatalf("%s %s: expected %d, got %d", test.method, test.target, test.code, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%s %s: unexpected content type %q", test.method, test.target, ct)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s %s: expected %s, got %s", test.method, test.target, test.want, body)
+		}
+	}
+
+	// Request errors are rendered with their details as an extension.
+	type request struct {
+		Name string `json:"name" validate:"required"`
+	}
+	router.PostFunc("/users", func(c *Context) {
+		var req request
+		if err := c.BindAndValidate(&req); err != nil {
+			c.WriteRequestError(err)
+		}
+	})
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+	want := `{"errors":[{"pointer":"/name","field":"Name","rule":"required","message":"is required"}],` +
+		`"status":422,"title":"Unprocessable Entity"}`
+	if rec.Code != http.StatusUnprocessableEntity || rec.Body.String() != want {
+		t.Fatalf("expected 422 %s, got %d %s", want, rec.Code, rec.Body.String())
+	}
+
+	// Without a renderer, helpers write plain text and the router only
+	// writes status codes.
+	router = NewRouter()
+	router.GetFunc("/", func(c *Context) {
+		c.Conflict("taken")
+	})
+	rec = serveRecorder(router, http.MethodGet, "/")
+	if rec.Code != http.StatusConflict || rec.Body.String() != "taken\n" ||
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected response: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if rec := serveRecorder(router, http.MethodGet, "/missing"); rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Fatalf("unexpected response: %d %q", rec.Code, rec.Body.String())
+	}
+}
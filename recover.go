@@ -0,0 +1,65 @@
+package jmux
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicHook is called with the request, the panic value, and the stack trace
+// when a router with recovery enabled recovers from a panic (see
+// WithRecovery).
+type PanicHook func(r *http.Request, v any, stack []byte)
+
+// WithRecovery enables recovering from panics in any of the router's handlers
+// (route, HandleAny, Default, MethodNotAllowed, and NotFound handlers, as well
+// as middleware). When a handler panics, the hook is called, then an
+// InternalServerError (500) is written using the router's error renderer (see
+// WithErrorRenderer), unless the response has already started. If the hook
+// is nil, the panic is logged with the standard logger. Panics with
+// http.ErrAbortHandler are re-panicked, so the server aborts the response.
+// Disabled by default, leaving panics to the server.
+func WithRecovery(hook PanicHook) RouterOption {
+	return func(router *Router) {
+		if hook == nil {
+			hook = logPanic
+		}
+		router.panicHook = hook
+	}
+}
+
+// logPanic is the default PanicHook.
+func logPanic(r *http.Request, v any, stack []byte) {
+	log.Printf("jmux: panic serving %s %s: %v\n%s", r.Method, r.URL, v, stack)
+}
+
+// trackResponse makes the context track whether its response has started, if
+// the router recovers from panics. Returns whether it does.
+func (router *Router) trackResponse(c *Context) bool {
+	if router.panicHook == nil {
+		return false
+	}
+	c.rw = responseWriter{ResponseWriter: c.Writer}
+	c.Writer = &c.rw
+	return true
+}
+
+// recoverPanic recovers from a panic while serving the request, if any,
+// releasing the context afterwards. Must be deferred.
+func (router *Router) recoverPanic(c *Context) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	router.panicHook(c.Request, v, debug.Stack())
+	if !c.rw.started {
+		// Write to the response directly, bypassing any writers set by
+		// middleware.
+		c.Writer = &c.rw
+		router.renderError(c, http.StatusInternalServerError)
+	}
+	releaseContext(c)
+}
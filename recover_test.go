@@ -0,0 +1,117 @@
+package jmux
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	type recovered struct {
+		path  string
+		value any
+		stack string
+	}
+	var got []recovered
+	router := NewRouter(
+		WithRecovery(func(r *http.Request, v any, stack []byte) {
+			got = append(got, recovered{r.URL.Path, v, string(stack)})
+		}),
+		WithErrorRenderer(RenderProblem),
+	)
+	router.GetFunc("/panic", func(c *Context) {
+		panic("boom")
+	})
+	router.GetFunc("/partial", func(c *Context) {
+		c.WriteHeader(http.StatusAccepted)
+		c.WriteString("partial")
+		panic("late")
+	})
+	router.GetE("/error", func(c *Context) error {
+		panic("from E")
+	})
+	router.GetFunc("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+	router.GetFunc("/ok", func(c *Context) {
+		c.WriteString("ok")
+	})
+	router.Group("/any", nil).Route().HandleAnyFunc(MethodsAll(), func(c *Context) {
+		panic("any")
+	})
+	router.DefaultPrefixFunc("/prefix", MethodsAll(), func(c *Context) {
+		panic("prefix default")
+	})
+	router.NotFoundFunc(func(c *Context) {
+		panic("not found")
+	})
+	router.Host("api.example.com").GetFunc("/", func(c *Context) {
+		panic("host")
+	})
+
+	const problem = `{"status":500,"title":"Internal Server Error"}`
+	tests := []struct {
+		method, target string
+		code           int
+		body           string
+		value          any
+	}{
+		{http.MethodGet, "/panic", http.StatusInternalServerError, problem, "boom"},
+		{http.MethodHead, "/panic", http.StatusInternalServerError, problem, "boom"},
+		{http.MethodGet, "/partial", http.StatusAccepted, "partial", "late"},
+		{http.MethodGet, "/error", http.StatusInternalServerError, problem, "from E"},
+		{http.MethodGet, "/any/x", http.StatusInternalServerError, problem, "any"},
+		{http.MethodGet, "/prefix/x", http.StatusInternalServerError, problem, "prefix default"},
+		{http.MethodGet, "/missing", http.StatusInternalServerError, problem, "not found"},
+		{http.MethodGet, "http://api.example.com/", http.StatusInternalServerError, problem, "host"},
+		{http.MethodGet, "/ok", http.StatusOK, "ok", nil},
+	}
+	for _, test := range tests {
+		got = nil
+		rec := serveRecorder(router, test.method, test.target)
+		if rec.Code != test.code {
+			t.Fatalf("%s %s: expected %d, got %d", test.method, test.target, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.body {
+			t.Fatalf("%s %s: expected %q, got %q", test.method, test.target, test.body, body)
+		}
+		if test.value == nil {
+			if len(got) != 0 {
+				t.Fatalf("%s %s: unexpected panic %v", test.method, test.target, got[0].value)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0].value != test.value {
+			t.Fatalf("%s %s: expected panic %v, got %v", test.method, test.target, test.value, got)
+		}
+		if !strings.Contains(got[0].stack, "recover_test.go") {
+			t.Fatalf("%s %s: expected stack of the panic, got:\n%s", test.method, test.target, got[0].stack)
+		}
+	}
+
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Fatalf("expected http.ErrAbortHandler to be re-panicked, got %v", v)
+			}
+		}()
+		serveRecorder(router, http.MethodGet, "/abort")
+	}()
+	if len(got) != 0 {
+		t.Fatalf("expected hook not to be called for http.ErrAbortHandler, got %v", got)
+	}
+
+	// Without recovery, panics are left to the server.
+	router = NewRouter()
+	router.GetFunc("/panic", func(c *Context) {
+		panic("boom")
+	})
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Fatalf("expected panic, got %v", v)
+			}
+		}()
+		serveRecorder(router, http.MethodGet, "/panic")
+	}()
+}
@@ -0,0 +1,115 @@
+package jmux
+
+import (
+	"net/http"
+	urlpkg "net/url"
+	"path"
+	"strings"
+)
+
+// RedirectPolicy is a set of policies for redirecting requests for
+// non-canonical paths to the canonical path of a route.
+type RedirectPolicy uint8
+
+const (
+	// RedirectNone is the strict policy, where paths only match routes as
+	// registered. This is the default.
+	RedirectNone RedirectPolicy = 0
+	// RedirectTrailingSlash redirects requests that don't match a route to the
+	// path with the trailing slash added or removed, if that path matches a
+	// route (e.g., with a route of "/users/", "/users" is redirected to
+	// "/users/").
+	RedirectTrailingSlash RedirectPolicy = 1 << (iota - 1)
+	// RedirectCleanPath redirects requests for paths containing "." or ".."
+	// elements or repeated slashes, which don't match a route, to the
+	// cleaned path (see path.Clean), if that path matches a route (e.g.,
+	// "/a//b/../c" is redirected to "/a/c"). The trailing slash is kept,
+	// unless RedirectTrailingSlash is also set and only the cleaned path
+	// without it (or with it added) matches a route.
+	RedirectCleanPath
+	// RedirectAll is all of the redirect policies.
+	RedirectAll = RedirectTrailingSlash | RedirectCleanPath
+)
+
+// WithRedirect sets the policies for redirecting requests for non-canonical
+// paths. Requests are only redirected if they don't match a route as is, and
+// are redirected before falling back to HandleAny, Default, or NotFound
+// handlers. GET and HEAD requests are redirected with a MovedPermanently (301)
+// status, and all others with a PermanentRedirect (308) status so that the
+// method and body are kept. The query is kept. Mounted routers don't redirect
+// requests, since they only see part of the path. Defaults to RedirectNone.
+func WithRedirect(policy RedirectPolicy) RouterOption {
+	return func(router *Router) {
+		router.redirect = policy
+	}
+}
+
+// RedirectPolicy returns the router's redirect policies.
+func (router *Router) RedirectPolicy() RedirectPolicy {
+	return router.redirect
+}
+
+// redirectPath returns the canonical path to redirect the request to, if
+// any, using the router's redirect policies. The path is the request's path
+// without the leading slash. Params is used as scratch space.
+func (router *Router) redirectPath(
+	s *snapshot, r *http.Request, urlPath string, params *[]pathParam,
+) (string, bool) {
+	if router.redirect == RedirectNone || r.Method == http.MethodConnect ||
+		strings.TrimPrefix(router.requestPath(r), "/") != urlPath {
+		return "", false
+	}
+	matches := func(p string) bool {
+		*params = (*params)[:0]
+		return router.match(s.tree, p[1:], r, params) != nil
+	}
+	p := "/" + urlPath
+	if router.redirect&RedirectCleanPath != 0 {
+		if cleaned := cleanPath(p); cleaned != p {
+			if matches(cleaned) {
+				return cleaned, true
+			}
+			p = cleaned
+		}
+	}
+	if router.redirect&RedirectTrailingSlash != 0 && p != "/" {
+		if strings.HasSuffix(p, "/") {
+			p = p[:len(p)-1]
+		} else {
+			p += "/"
+		}
+		if matches(p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// sendRedirect redirects the request to the path, keeping the query. The path
+// is escaped unless the router routes escaped paths, in which case it already
+// is.
+func (router *Router) sendRedirect(w http.ResponseWriter, r *http.Request, p string) {
+	target := p
+	if !router.escapedPath {
+		target = (&urlpkg.URL{Path: p}).EscapedPath()
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(code)
+}
+
+// cleanPath cleans the path (which must start with a slash), keeping any
+// trailing slash.
+func cleanPath(p string) string {
+	cleaned := path.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
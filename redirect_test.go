@@ -0,0 +1,87 @@
+package jmux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	newRouter := func(policy RedirectPolicy) *Router {
+		router := NewRouter(WithRedirect(policy))
+		router.GetFunc("/users/", func(c *Context) {
+			c.WriteString("users")
+		})
+		router.GetFunc("/users/{id}", func(c *Context) {
+			c.WriteString("user=" + c.Params["id"])
+		})
+		router.PostFunc("/items", func(c *Context) {
+			c.WriteString("items")
+		})
+		router.GetFunc("/a/b", func(c *Context) {
+			c.WriteString("ab")
+		})
+		return router
+	}
+
+	tests := []struct {
+		policy         RedirectPolicy
+		method, target string
+		code           int
+		location       string
+	}{
+		// Strict matching, as registered.
+		{RedirectNone, http.MethodGet, "/users", http.StatusNotFound, ""},
+		{RedirectNone, http.MethodGet, "/users/", http.StatusOK, ""},
+		{RedirectNone, http.MethodGet, "/a//b", http.StatusNotFound, ""},
+
+		{RedirectTrailingSlash, http.MethodGet, "/users", http.StatusMovedPermanently, "/users/"},
+		{RedirectTrailingSlash, http.MethodHead, "/users?page=2", http.StatusMovedPermanently, "/users/?page=2"},
+		{RedirectTrailingSlash, http.MethodGet, "/users/1/", http.StatusMovedPermanently, "/users/1"},
+		{RedirectTrailingSlash, http.MethodPost, "/items/", http.StatusPermanentRedirect, "/items"},
+		{RedirectTrailingSlash, http.MethodGet, "/items/", http.StatusNotFound, ""},
+		{RedirectTrailingSlash, http.MethodGet, "/a//b", http.StatusNotFound, ""},
+		{RedirectTrailingSlash, http.MethodGet, "/users/", http.StatusOK, ""},
+
+		{RedirectCleanPath, http.MethodGet, "/a//b", http.StatusMovedPermanently, "/a/b"},
+		{RedirectCleanPath, http.MethodGet, "/a/./c/../b?x=1", http.StatusMovedPermanently, "/a/b?x=1"},
+		{RedirectCleanPath, http.MethodPost, "//items", http.StatusPermanentRedirect, "/items"},
+		{RedirectCleanPath, http.MethodGet, "/users//a%20b", http.StatusMovedPermanently, "/users/a%20b"},
+		{RedirectCleanPath, http.MethodGet, "/users", http.StatusNotFound, ""},
+		{RedirectCleanPath, http.MethodGet, "/a//b/", http.StatusNotFound, ""},
+
+		{RedirectAll, http.MethodGet, "/a//b/", http.StatusMovedPermanently, "/a/b"},
+		{RedirectAll, http.MethodGet, "//users", http.StatusMovedPermanently, "/users/"},
+		{RedirectAll, http.MethodGet, "/other", http.StatusNotFound, ""},
+	}
+	routers := make(map[RedirectPolicy]*Router)
+	for _, test := range tests {
+		router := routers[test.policy]
+		if router == nil {
+			router = newRouter(test.policy)
+			routers[test.policy] = router
+		}
+		if router.RedirectPolicy() != test.policy {
+			t.Fatalf("expected policy %d, got %d", test.policy, router.RedirectPolicy())
+		}
+		rec := serveRecorder(router, test.method, test.target)
+		if rec.Code != test.code {
+			t.Fatalf(
+				"policy %d: %s %s: expected %d, got %d",
+				test.policy, test.method, test.target, test.code, rec.Code,
+			)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.location {
+			t.Fatalf(
+				"policy %d: %s %s: expected location %q, got %q",
+				test.policy, test.method, test.target, test.location, loc,
+			)
+		}
+	}
+
+	// Mounted routers don't redirect.
+	router := NewRouter()
+	router.Mount("/api", newRouter(RedirectAll))
+	if rec := serveRecorder(router, http.MethodGet, "/api/users"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 from mounted router, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,478 @@
+package jmux
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrMalformedPattern is returned (wrapped in a RouteError) when a pattern
+	// can't be parsed (e.g., it has unbalanced braces or an empty parameter
+	// name).
+	ErrMalformedPattern = errors.New("malformed pattern")
+	// ErrDuplicateHandler is returned (wrapped in a RouteError) when a handler
+	// is already registered for the pattern and method.
+	ErrDuplicateHandler = errors.New("duplicate handler")
+	// ErrAmbiguousPattern is returned (wrapped in a RouteError) when a
+	// parameter in the pattern is equivalent to, but named differently than, a
+	// parameter of an existing route (e.g., "/users/{uid}" when "/users/{id}"
+	// exists), so only one of them could ever match.
+	ErrAmbiguousPattern = errors.New("ambiguous pattern")
+)
+
+// RouteError is an error describing why a route couldn't be registered.
+type RouteError struct {
+	// The pattern being registered
+	Pattern string
+	// The conflicting methods, if any, in sorted order
+	Methods []string
+	// The pattern of the existing route conflicting with the pattern, if any
+	Conflict string
+	// The name of the existing handler conflicting with the handler, if any
+	Handler string
+	// The reason for the error, wrapping one of ErrMalformedPattern,
+	// ErrDuplicateHandler, or ErrAmbiguousPattern
+	Err error
+}
+
+// Error implements the error interface.
+func (e *RouteError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("jmux: pattern ")
+	fmt.Fprintf(&sb, "%q", e.Pattern)
+	if len(e.Methods) != 0 {
+		sb.WriteString(" [" + strings.Join(e.Methods, ", ") + "]")
+	}
+	sb.WriteString(": " + e.Err.Error())
+	if e.Conflict != "" {
+		fmt.Fprintf(&sb, ": conflicts with %q", e.Conflict)
+		if e.Handler != "" {
+			sb.WriteString(" (" + e.Handler + ")")
+		}
+	}
+	return sb.String()
+}
+
+// Unwrap returns the reason for the error.
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// WithStrict sets whether the router is in strict mode. In strict mode,
+// registering a duplicate handler or an ambiguous pattern (see TryHandle)
+// panics with a *RouteError rather than replacing the handler or adding the
+// route. Handlers registered with matchers using Router.HandleMatch never
+// replace other handlers, so they don't conflict with them. Defaults to
+// false.
+func WithStrict(enabled bool) RouterOption {
+	return func(router *Router) {
+		router.strict = enabled
+	}
+}
+
+// TryHandle is like Handle, but returns an error rather than registering the
+// route if the pattern is malformed, if a handler is already registered for
+// the pattern and any of the given methods, or if a parameter in the pattern
+// is ambiguous with a parameter of an existing route. The error is always a
+// *RouteError.
+func (router *Router) TryHandle(pattern string, methods Methods, h Handler) (*Route, error) {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	return router.register(pattern, methods, h, nil, true)
+}
+
+// TryHandle is like Handle, but returns an error rather than registering the
+// route if it conflicts with an existing route. See Router.TryHandle.
+func (g *Group) TryHandle(pattern string, methods Methods, h Handler) (*Route, error) {
+	return g.router.TryHandle(joinPattern(g.prefix, pattern), methods, g.wrap(h))
+}
+
+// register registers the handler for the pattern and methods, with the given
+// matchers, if any (see Router.HandleMatch). Returns the route for the
+// pattern. An error is returned if the pattern is malformed, or, if strict is
+// true, if it (or the shorter paths it matches when it has optional
+// parameters) conflicts with an existing route, in which case nothing is
+// registered.
+func (router *Router) register(
+	pattern string, methods Methods, h Handler, matchers []Matcher, strict bool,
+) (*Route, error) {
+	segs, err := router.parseRoute(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := router.checkMount(pattern, segs); err != nil {
+		return nil, err
+	}
+	if strict {
+		for _, segs := range expandOptional(segs) {
+			err := router.checkConflict(pattern, segs, methods, len(matchers) != 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return router.insertRoute(segs, methods, h, matchers), nil
+}
+
+// parseRoute parses the pattern into its segments.
+func (router *Router) parseRoute(pattern string) ([]segment, error) {
+	if pattern == "" {
+		return nil, &RouteError{
+			Pattern: pattern,
+			Err:     fmt.Errorf("%w: empty pattern", ErrMalformedPattern),
+		}
+	}
+	segs, err := parsePattern(router, strings.TrimPrefix(pattern, "/"))
+	if err != nil {
+		return nil, &RouteError{
+			Pattern: pattern,
+			Err:     fmt.Errorf("%w: %v", ErrMalformedPattern, err),
+		}
+	}
+	return segs, nil
+}
+
+// checkMount checks that the parsed pattern doesn't end in a catch-all
+// parameter where a router is mounted (see Router.Mount), or, if it's the
+// pattern used to mount a router, that no other catch-all parameter is
+// registered there, since one would take the requests of the other.
+func (router *Router) checkMount(pattern string, segs []segment) error {
+	if len(segs) == 0 || !segs[len(segs)-1].catchAll {
+		return nil
+	}
+	route := router.base
+	for _, seg := range segs[:len(segs)-1] {
+		if !seg.param {
+			route = route.routes[seg.name]
+		} else {
+			route = route.getParam(seg.pattern)
+		}
+		if route == nil {
+			return nil
+		}
+	}
+	last := segs[len(segs)-1]
+	for _, ro := range route.params {
+		if !ro.catchAll || ro.parts != nil || ro.name == last.name {
+			continue
+		}
+		if last.name == mountParam {
+			return &RouteError{
+				Pattern:  route.fullPattern(nil),
+				Conflict: ro.fullPattern(nil),
+				Err:      fmt.Errorf("%w: can't mount a router over a catch-all parameter", ErrAmbiguousPattern),
+			}
+		} else if ro.name == mountParam {
+			return &RouteError{
+				Pattern:  pattern,
+				Conflict: route.fullPattern(nil),
+				Err:      fmt.Errorf("%w: catch-all parameter under a mounted router", ErrAmbiguousPattern),
+			}
+		}
+	}
+	return nil
+}
+
+// checkConflict checks the parsed pattern against the existing routes. If
+// variant is true, the handler being registered has matchers, so it only
+// conflicts with ambiguous patterns, since handlers with matchers don't
+// replace other handlers.
+func (router *Router) checkConflict(
+	pattern string, segs []segment, methods Methods, variant bool,
+) error {
+	route := router.base
+	for _, seg := range segs {
+		var r *Route
+		if !seg.param {
+			r = route.routes[seg.name]
+		} else if r = route.getParam(seg.pattern); r == nil {
+			for _, ro := range route.params {
+				if ro.shape == seg.shape {
+					return &RouteError{
+						Pattern:  pattern,
+						Conflict: ro.fullPattern(nil),
+						Err:      ErrAmbiguousPattern,
+					}
+				}
+			}
+		}
+		if r == nil {
+			return nil
+		}
+		route = r
+	}
+	if variant {
+		return nil
+	}
+	var conflicts []string
+	var conflict *Route
+	for method := range methods {
+		if ro := route.handlerRoute(method); ro != nil {
+			conflicts = append(conflicts, method)
+			conflict = ro
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	sort.Strings(conflicts)
+	if ro := route.handlerRoute(conflicts[0]); ro != nil {
+		conflict = ro
+	}
+	return &RouteError{
+		Pattern:  pattern,
+		Methods:  conflicts,
+		Conflict: conflict.fullPattern(conflict.optional[conflicts[0]]),
+		Handler:  handlerName(conflict.handlers[conflicts[0]]),
+		Err:      ErrDuplicateHandler,
+	}
+}
+
+// handlerRoute returns the route whose handler for the method matches the
+// route's path, which is either the route itself or a descendant with enough
+// trailing optional parameters to leave out. Returns nil if there is none.
+func (route *Route) handlerRoute(method string) *Route {
+	if route.handlers[method] != nil {
+		return route
+	}
+	return route.absentRoute(method, 1)
+}
+
+// absentRoute returns the descendant route, depth levels below the route,
+// whose handler for the method was registered with enough trailing optional
+// parameters to match the route's path. Returns nil if there is none.
+func (route *Route) absentRoute(method string, depth int) *Route {
+	for _, ro := range route.params {
+		if ro.handlers[method] != nil && len(ro.optional[method]) >= depth {
+			return ro
+		}
+		if found := ro.absentRoute(method, depth+1); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Batch calls fn, holding back the changes it makes to the router from
+// requests until it returns, so that requests are served using either none or
+// all of them. This allows a route to be registered along with its
+// configuration (e.g., middleware added with Route.Use, matchers, or HandleAny
+// handlers) without requests being served by the route before it's
+// configured. While fn runs, requests are served using the routes as they
+// were before it was called. Batches may be nested or run concurrently, in
+// which case the changes are only used once none are running. Changes to
+// host routers (see Router.Host) are only held back by their own batches.
+func (router *Router) Batch(fn func()) {
+	router.mtx.Lock()
+	router.batches++
+	router.mtx.Unlock()
+	defer func() {
+		router.mtx.Lock()
+		router.batches--
+		router.mtx.Unlock()
+	}()
+	fn()
+}
+
+// Remove removes the handlers for the given methods (including handlers with
+// matchers) from the route with the given pattern, which must be written the
+// same way as when the handlers were registered (e.g., "/users/{uid}" doesn't
+// match a route registered as "/users/{id}"). Routes left without handlers
+// (of any kind), child routes, or a name are removed as well. If the methods
+// contain the wildcard method (MethodAll), the handlers for every method are
+// removed. Reports whether any handlers were removed. Routes can be removed
+// while the router is serving requests.
+func (router *Router) Remove(pattern string, methods Methods) bool {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	segs, err := router.parseRoute(pattern)
+	if err != nil {
+		return false
+	}
+	return router.remove(segs, methods)
+}
+
+// remove removes the handlers for the given methods from the route for the
+// parsed pattern.
+func (router *Router) remove(segs []segment, methods Methods) bool {
+	route := router.base
+	for _, seg := range segs {
+		if seg.param {
+			route = route.getParam(seg.pattern)
+		} else {
+			route = route.routes[seg.name]
+		}
+		if route == nil {
+			return false
+		}
+	}
+	if methods.Has(MethodAll) {
+		methods = route.allMethods()
+	}
+	removed := route.removeVariants(methods)
+	for method := range methods {
+		if _, ok := route.handlers[method]; ok {
+			delete(route.handlers, method)
+			delete(route.optional, method)
+			removed = true
+		}
+	}
+	if !removed {
+		return false
+	}
+	route.last = nil
+	route.compose()
+	route.prune()
+	return true
+}
+
+// allMethods returns the methods of all the route's handlers, including
+// handlers with matchers.
+func (route *Route) allMethods() Methods {
+	methods := make(Methods, len(route.handlers))
+	for method := range route.handlers {
+		methods[method] = Unit{}
+	}
+	for _, v := range route.variants {
+		for method := range v.methods {
+			methods[method] = Unit{}
+		}
+	}
+	return methods
+}
+
+// Remove removes the route, along with its handlers and child routes, from
+// the router, freeing the names of the removed routes. Removing the router's
+// base route removes every route (but keeps the base route's middleware).
+// Does nothing if the route was already removed. Routes can be removed while
+// the router is serving requests.
+func (route *Route) Remove() {
+	router := route.router
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	if !route.attached() {
+		return
+	}
+	route.unname()
+	if route.parent == nil {
+		route.methods = make(Methods)
+		route.matchAny = make(map[string]Handler)
+		route.routes = make(map[string]*Route)
+		route.params = nil
+		route.handlers = make(map[string]Handler)
+		route.optional = nil
+		route.variants, route.last = nil, nil
+		route.defaults = nil
+		route.compose()
+		return
+	}
+	route.detach()
+	route.parent.prune()
+	router.markDirty()
+}
+
+// attached returns whether the route is still part of the router's routes.
+func (route *Route) attached() bool {
+	ro := route
+	for ; ro.parent != nil; ro = ro.parent {
+		parent := ro.parent
+		if ro.param {
+			if parent.getParam(ro.pattern) != ro {
+				return false
+			}
+		} else if parent.routes[ro.name] != ro {
+			return false
+		}
+	}
+	return ro == route.router.base
+}
+
+// detach removes the route from its parent.
+func (route *Route) detach() {
+	parent := route.parent
+	if !route.param {
+		delete(parent.routes, route.name)
+		return
+	}
+	for i, ro := range parent.params {
+		if ro == route {
+			parent.params = append(parent.params[:i], parent.params[i+1:]...)
+			break
+		}
+	}
+}
+
+// unname frees the names of the route and its children.
+func (route *Route) unname() {
+	if route.routeName != "" {
+		delete(route.router.names, route.routeName)
+		route.routeName = ""
+	}
+	for _, ro := range route.routes {
+		ro.unname()
+	}
+	for _, ro := range route.params {
+		ro.unname()
+	}
+}
+
+// prune removes the route, and then its ancestors, while they're empty (see
+// Route.empty), and then updates the methods of the remaining ancestors.
+func (route *Route) prune() {
+	for route.parent != nil && route.empty() {
+		route.detach()
+		route = route.parent
+	}
+	for ; route != nil; route = route.parent {
+		methods := make(Methods)
+		for method := range route.handlers {
+			methods.Set(method)
+		}
+		for _, v := range route.variants {
+			methods.CopyFrom(v.methods)
+		}
+		for _, ro := range route.routes {
+			methods.CopyFrom(ro.methods)
+		}
+		for _, ro := range route.params {
+			methods.CopyFrom(ro.methods)
+		}
+		route.methods = methods
+	}
+}
+
+// empty returns whether the route has no handlers (of any kind), child
+// routes, or name.
+func (route *Route) empty() bool {
+	return len(route.handlers) == 0 && len(route.matchAny) == 0 &&
+		len(route.variants) == 0 && len(route.defaults) == 0 &&
+		len(route.routes) == 0 && len(route.params) == 0 &&
+		route.routeName == ""
+}
+
+// expandOptional returns the parsed patterns the parsed pattern matches the
+// paths of, from the full pattern to the pattern with all of its (trailing)
+// optional parameters left out.
+func expandOptional(segs []segment) [][]segment {
+	expansions := [][]segment{segs}
+	for len(segs) != 0 && segs[len(segs)-1].optional {
+		segs = segs[:len(segs)-1]
+		expansions = append(expansions, segs)
+	}
+	return expansions
+}
+
+// trailingOptional returns the trailing optional parameters of the parsed
+// pattern, if any.
+func trailingOptional(segs []segment) []segment {
+	i := len(segs)
+	for i > 0 && segs[i-1].optional {
+		i--
+	}
+	if i == len(segs) {
+		return nil
+	}
+	return segs[i:]
+}
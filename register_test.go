@@ -0,0 +1,311 @@
+package jmux
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTryHandle(t *testing.T) {
+	getUser := HandlerFunc(func(c *Context) {
+		c.WriteString("user=" + c.Params["id"])
+	})
+	router := NewRouter()
+	router.Get("/users/{id}", getUser)
+	router.Get("/users/{id}/posts", getUser)
+	router.Get("/files/{name}.{ext}", getUser)
+
+	tests := []struct {
+		pattern string
+		methods Methods
+		err     error
+	}{
+		{"/users/{id}", MethodsGet(), ErrDuplicateHandler},
+		{"/users/{id}", MethodsPost(), nil},
+		{"/users/{uid}", MethodsPost(), ErrAmbiguousPattern},
+		{"/users/{uid}/likes", MethodsGet(), ErrAmbiguousPattern},
+		{"/users/{id:int}", MethodsGet(), nil},
+		{"/users/{id}/likes", MethodsGet(), nil},
+		{"/users/me", MethodsGet(), nil},
+		{"/files/{base}.{ext}", MethodsGet(), ErrAmbiguousPattern},
+		{"/files/{name}-{ext}", MethodsGet(), nil},
+		{"/bad/{name", MethodsGet(), ErrMalformedPattern},
+		{"/bad/name}", MethodsGet(), ErrMalformedPattern},
+		{"/bad/{}", MethodsGet(), ErrMalformedPattern},
+		{"/bad/{:int}", MethodsGet(), ErrMalformedPattern},
+		{"/bad/{id}/{id}", MethodsGet(), ErrMalformedPattern},
+		{"/bad/{path...}/more", MethodsGet(), ErrMalformedPattern},
+		{"/bad/{id:nope}", MethodsGet(), ErrMalformedPattern},
+		{"", MethodsGet(), ErrMalformedPattern},
+	}
+	for _, test := range tests {
+		route, err := router.TryHandle(test.pattern, test.methods, getUser)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected error %v, got %v", test.pattern, test.err, err)
+		}
+		if err == nil {
+			if route == nil {
+				t.Fatalf("%s: expected route", test.pattern)
+			}
+			continue
+		}
+		if route != nil {
+			t.Fatalf("%s: expected nil route on error", test.pattern)
+		}
+		var re *RouteError
+		if !errors.As(err, &re) || re.Pattern != test.pattern {
+			t.Fatalf("%s: expected *RouteError, got %#v", test.pattern, err)
+		}
+	}
+
+	// Failed registrations shouldn't affect routing.
+	rec := serveRecorder(router, http.MethodPost, "/users/1")
+	if body := rec.Body.String(); body != "user=1" {
+		t.Fatalf("expected user=1, got %q", body)
+	}
+	if rec := serveRecorder(router, http.MethodGet, "/bad/x"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+
+	_, err := router.TryHandle("/users/{id}", MethodsGet(), getUser)
+	var re *RouteError
+	if !errors.As(err, &re) {
+		t.Fatalf("expected *RouteError, got %v", err)
+	}
+	if re.Conflict != "/users/{id}" || len(re.Methods) != 1 || re.Methods[0] != http.MethodGet {
+		t.Fatalf("unexpected error: %#v", re)
+	}
+	if !strings.Contains(re.Handler, "TestTryHandle") {
+		t.Fatalf("expected handler name in error, got %q", re.Handler)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	expectPanic := func(router *Router, pattern string, want error) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			err, _ := recover().(error)
+			if !errors.Is(err, want) {
+				t.Fatalf("%s: expected panic with %v, got %v", pattern, want, err)
+			}
+		}()
+		router.GetFunc(pattern, func(c *Context) {})
+	}
+
+	router := NewRouter(WithStrict(true))
+	router.GetFunc("/users/{id}", func(c *Context) {})
+	expectPanic(router, "/users/{id}", ErrDuplicateHandler)
+	expectPanic(router, "/users/{uid}", ErrAmbiguousPattern)
+	expectPanic(router, "/users/{id", ErrMalformedPattern)
+
+	// Outside of strict mode, duplicates replace the handler.
+	router = NewRouter()
+	router.GetFunc("/", func(c *Context) { c.WriteString("first") })
+	router.GetFunc("/", func(c *Context) { c.WriteString("second") })
+	if body := serveRecorder(router, http.MethodGet, "/").Body.String(); body != "second" {
+		t.Fatalf("expected second, got %q", body)
+	}
+	expectPanic(router, "/{}", ErrMalformedPattern)
+}
+
+func TestRemove(t *testing.T) {
+	router := NewRouter()
+	users := router.GetFunc("/users/{id}", func(c *Context) {
+		c.WriteString("get=" + c.Params["id"])
+	})
+	router.PostFunc("/users/{id}", func(c *Context) {
+		c.WriteString("post=" + c.Params["id"])
+	})
+	router.GetFunc("/users/{id}/posts/{post}", func(c *Context) {
+		c.WriteString("post")
+	}).Name("post")
+	router.GetFunc("/files/{path...}", func(c *Context) {
+		c.WriteString(c.Params["path"])
+	})
+	router.GetFunc("/files/{name:int}", func(c *Context) {
+		c.WriteString("int")
+	})
+
+	expect := func(method, path, want string, code int) {
+		t.Helper()
+		rec := serveRecorder(router, method, path)
+		if rec.Code != code {
+			t.Fatalf("%s %s: expected %d, got %d", method, path, code, rec.Code)
+		}
+		if body := rec.Body.String(); body != want {
+			t.Fatalf("%s %s: expected %q, got %q", method, path, want, body)
+		}
+	}
+	expect(http.MethodPost, "/users/1", "post=1", http.StatusOK)
+
+	if router.Remove("/users/{uid}", MethodsPost()) {
+		t.Fatal("expected nothing to be removed for a differently named pattern")
+	}
+	if router.Remove("/users/{id}", MethodsPut()) {
+		t.Fatal("expected nothing to be removed for an unregistered method")
+	}
+	if !router.Remove("/users/{id}", MethodsPost()) {
+		t.Fatal("expected POST handler to be removed")
+	}
+	expect(http.MethodPost, "/users/1", "", http.StatusMethodNotAllowed)
+	expect(http.MethodGet, "/users/1", "get=1", http.StatusOK)
+	expect(http.MethodGet, "/users/1/posts/2", "post", http.StatusOK)
+
+	// Removing a route removes its children and frees their names.
+	users.Remove()
+	users.Remove()
+	expect(http.MethodGet, "/users/1", "", http.StatusNotFound)
+	expect(http.MethodGet, "/users/1/posts/2", "", http.StatusNotFound)
+	if _, err := router.URL("post", "id", "1", "post", "2"); err == nil {
+		t.Fatal("expected name to be freed")
+	}
+	if table := router.Routes(); len(table) != 2 {
+		t.Fatalf("expected 2 routes, got:\n%s", table)
+	}
+
+	if !router.Remove("/files/{name:int}", MethodsGet()) {
+		t.Fatal("expected constrained handler to be removed")
+	}
+	expect(http.MethodGet, "/files/1", "1", http.StatusOK)
+
+	// The wildcard method removes the handlers for every method.
+	router.GetFunc("/a", func(c *Context) {})
+	router.HandleFunc("/a", MethodsAll(), func(c *Context) {})
+	router.HandleMatch("/a", MethodsPost(), HandlerFunc(func(c *Context) {}), MatchHeaders("X-A", ""))
+	if !router.Remove("/a", MethodsAll()) {
+		t.Fatal("expected all handlers to be removed")
+	}
+	expect(http.MethodGet, "/a", "", http.StatusNotFound)
+	if router.Remove("/a", MethodsAll()) {
+		t.Fatal("expected nothing to be removed")
+	}
+
+	router.Handle("/", make(Methods), nil).Remove()
+	expect(http.MethodGet, "/files/1", "", http.StatusNotFound)
+	if table := router.Routes(); len(table) != 0 {
+		t.Fatalf("expected no routes, got:\n%s", table)
+	}
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/static", func(c *Context) {
+		c.WriteString("static")
+	})
+	auth := func(next Handler) Handler {
+		return HandlerFunc(func(c *Context) {
+			if c.Request.Header.Get("Authorization") == "" {
+				c.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeC(c)
+		})
+	}
+	const workers, iters = 4, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		w := w
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iters; i++ {
+				pattern := fmt.Sprintf("/plugins/%d/{id}", w)
+				router.Batch(func() {
+					router.GetFunc(pattern, func(c *Context) {
+						c.WriteString(c.Params["id"])
+					}).Use(auth)
+				})
+				router.Remove(pattern, MethodsGet())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iters; i++ {
+				// The handler is never served before its middleware is added.
+				path := fmt.Sprintf("/plugins/%d/%d", w, i)
+				if rec := serveRecorder(router, http.MethodGet, path); rec.Code == http.StatusOK {
+					t.Errorf("%s: served without auth", path)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iters; i++ {
+				route := router.GetFunc(fmt.Sprintf("/tmp/%d/%d", w, i), func(c *Context) {})
+				route.HandleAny(MethodsAll(), nil)
+				router.Routes()
+				route.Remove()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iters; i++ {
+				path := fmt.Sprintf("/plugins/%d/%d", w, i)
+				r := httptest.NewRequest(http.MethodGet, path, nil)
+				r.Header.Set("Authorization", "x")
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, r)
+				if rec.Code == http.StatusOK && rec.Body.String() != fmt.Sprint(i) {
+					t.Errorf("%s: got %q", path, rec.Body.String())
+				}
+				if body := serveRecorder(router, http.MethodGet, "/static").Body.String(); body != "static" {
+					t.Errorf("expected static, got %q", body)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if table := router.Routes(); len(table) != 1 {
+		t.Fatalf("expected only the static route, got:\n%s", table)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/old", func(c *Context) {})
+	serveRecorder(router, http.MethodGet, "/old")
+	router.Batch(func() {
+		route := router.GetFunc("/admin", func(c *Context) {
+			c.WriteString("admin")
+		})
+		router.Remove("/old", MethodsGet())
+		// Changes are held back until the batch is done, even when nested.
+		router.Batch(func() {})
+		if rec := serveRecorder(router, http.MethodGet, "/admin"); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 during batch, got %d", rec.Code)
+		}
+		if rec := serveRecorder(router, http.MethodGet, "/old"); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 during batch, got %d", rec.Code)
+		}
+		route.Use(func(next Handler) Handler {
+			return HandlerFunc(func(c *Context) {
+				c.WriteHeader(http.StatusUnauthorized)
+			})
+		})
+	})
+	if rec := serveRecorder(router, http.MethodGet, "/admin"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after batch, got %d", rec.Code)
+	}
+	if rec := serveRecorder(router, http.MethodGet, "/old"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after batch, got %d", rec.Code)
+	}
+
+	// The changes are used even if the batch panics.
+	func() {
+		defer func() {
+			recover()
+		}()
+		router.Batch(func() {
+			router.GetFunc("/new", func(c *Context) {})
+			panic("boom")
+		})
+	}()
+	if rec := serveRecorder(router, http.MethodGet, "/new"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after panicking batch, got %d", rec.Code)
+	}
+}
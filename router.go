@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"net/http"
 	urlpkg "net/url"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type contextKeyType string
@@ -68,14 +71,37 @@ func (h HandlerFunc) ServeC(c *Context) {
 
 // Route is a route in a router.
 type Route struct {
-	name    string
-	param   bool
+	segment
 	methods Methods
 	// Used to match child routes that failed to match
 	matchAny map[string]Handler
-	routes   map[string]*Route
+	// Static child routes, keyed by slug
+	routes map[string]*Route
+	// Parameter child routes, in order of precedence
+	params   []*Route
 	handlers map[string]Handler
 	parent   *Route
+	router   *Router
+	// The name given with Route.Name
+	routeName string
+	// Handlers with matchers, in the order they were registered
+	variants []*variant
+	// The handler most recently registered, which matchers are added to
+	last *variant
+	// Default handlers for requests under the route (see
+	// Router.DefaultPrefix)
+	defaults map[string]Handler
+	// The trailing optional parameters of the patterns the handlers were
+	// registered with, by method, if they had any
+	optional map[string][]segment
+
+	middleware []Middleware
+	// The handlers, matchAny handlers, and variants wrapped with the
+	// middleware
+	composed         map[string]Handler
+	composedAny      map[string]Handler
+	composedVariants []variant
+	composedDefaults map[string]Handler
 }
 
 // MatchAny allows all of the given methods for the route. This makes the route
@@ -108,9 +134,12 @@ func (route *Route) MatchAny(methods Methods) *Route {
 // "/slug1/" will not fall back to "/slug1".
 // Returns the calling route.
 func (route *Route) HandleAny(methods Methods, h Handler) *Route {
+	route.router.mtx.Lock()
+	defer route.router.mtx.Unlock()
 	for method := range methods {
 		route.matchAny[method] = h
 	}
+	route.compose()
 	return route
 }
 
@@ -121,116 +150,188 @@ func (route *Route) HandleAnyFunc(methods Methods, f HandlerFunc) *Route {
 	return route.HandleAny(methods, f)
 }
 
-func (route *Route) getHandler(method string) Handler {
-	h := route.handlers[method]
-	if h == nil {
-		return route.handlers[MethodAll]
+// getParam returns the parameter child route with the given pattern (e.g.,
+// "{id}"), if any.
+func (route *Route) getParam(pattern string) *Route {
+	for _, ro := range route.params {
+		if ro.pattern == pattern {
+			return ro
+		}
 	}
-	return h
+	return nil
 }
 
-func (route *Route) getMatchAnyHandler(method string) Handler {
-	h, ok := route.matchAny[method]
-	if ok && h != nil {
-		return h
-	}
-	h, okAll := route.matchAny[MethodAll]
-	if okAll && h != nil {
-		return h
-	}
-	if !ok && !okAll {
-		return nil
-	}
-	return route.getHandler(method)
+// addParam adds the parameter child route, keeping the parameters ordered by
+// precedence. Parameters with equal precedence are kept in the order they
+// were added.
+func (route *Route) addParam(param *Route) {
+	route.params = append(route.params, param)
+	sort.SliceStable(route.params, func(i, j int) bool {
+		return route.params[i].rank() < route.params[j].rank()
+	})
 }
 
-func (route *Route) getParentMatch(method string) Handler {
-	if route.name != "/" {
-		if r := route.routes["/"]; r != nil {
-			h := r.getMatchAnyHandler(method)
-			if h != nil {
-				return h
-			}
-		}
-	} else {
-		route = route.parent
-		if route != nil {
-			route = route.parent
+// insert gets the route for the parsed pattern relative to the calling route,
+// creating routes as necessary, and sets the handler for the given methods.
+// If there are matchers, the handler is added as a variant with them instead.
+func (route *Route) insert(
+	segs []segment, methods Methods, h Handler, matchers []Matcher,
+) *Route {
+	for _, seg := range segs {
+		var r *Route
+		if seg.param {
+			r = route.getParam(seg.pattern)
+		} else {
+			r = route.routes[seg.name]
 		}
-	}
-	for ; route != nil; route = route.parent {
-		if handler := route.getMatchAnyHandler(method); handler != nil {
-			return handler
+		if r == nil {
+			r = &Route{
+				segment:  seg,
+				methods:  CopyMethods(methods),
+				matchAny: make(map[string]Handler),
+				routes:   make(map[string]*Route),
+				handlers: make(map[string]Handler),
+				parent:   route,
+				router:   route.router,
+			}
+			if seg.param {
+				route.addParam(r)
+			} else {
+				route.routes[seg.name] = r
+			}
+		} else {
+			r.methods.CopyFrom(methods)
 		}
+		route = r
 	}
-	return nil
-}
-
-func (route *Route) getRoute(pattern string, methods Methods, h Handler) *Route {
-	if pattern == "" {
-		for method := range methods {
-			route.handlers[method] = h
+	optional := trailingOptional(segs)
+	if len(matchers) != 0 {
+		route.last = &variant{
+			methods:  CopyMethods(methods),
+			handler:  h,
+			matchers: append([]Matcher(nil), matchers...),
+			optional: optional,
 		}
+		route.variants = append(route.variants, route.last)
+		route.compose()
 		return route
 	}
-	if pattern[0] == '/' {
-		pattern = pattern[1:]
-	}
-	lp := len(pattern)
-	l := nextSlug(pattern)
-	if l == -1 {
-		l = lp
-	}
-	slug, param := pattern[:l], false
-	if slug == "" {
-		slug = "/"
-	}
-	if slug[0] == '{' {
-		if slug[l-1] != '}' {
-			panic("missing closing brace in pattern: " + pattern)
-		}
-		slug = slug[1 : l-1]
-		param = true
-	}
-	r, ok := route.routes[slug]
-	if !ok {
-		r = &Route{
-			name:     slug,
-			param:    param,
+	if len(methods) != 0 {
+		route.last = &variant{
 			methods:  CopyMethods(methods),
-			matchAny: make(map[string]Handler),
-			routes:   make(map[string]*Route),
-			handlers: make(map[string]Handler),
-			parent:   route,
+			handler:  h,
+			optional: optional,
 		}
-		route.routes[slug] = r
-	} else {
-		r.methods.CopyFrom(methods)
 	}
-	if l == lp {
-		return r.getRoute("", methods, h)
+	for method := range methods {
+		if prev, ok := route.handlers[method]; ok {
+			if route.last.replaced == nil {
+				route.last.replaced = make(map[string]Handler)
+			}
+			route.last.replaced[method] = prev
+			if prev := route.optional[method]; prev != nil {
+				if route.last.replacedOptional == nil {
+					route.last.replacedOptional = make(map[string][]segment)
+				}
+				route.last.replacedOptional[method] = prev
+			}
+		}
+		route.handlers[method] = h
+		route.setOptional(method, optional)
+	}
+	route.compose()
+	return route
+}
+
+// setOptional sets the trailing optional parameters of the pattern the
+// handler for the method was registered with.
+func (route *Route) setOptional(method string, optional []segment) {
+	if len(optional) == 0 {
+		delete(route.optional, method)
+		return
 	}
-	/*
-	  // Ends with slash
-	  if pattern[lp-1] == '/' {
-	    return r.getRoute(pattern[l+1:]+"/", methods, h)
-	  }
-	*/
-	//return r.getRoute(pattern[l+1:], methods, h)
-	return r.getRoute(pattern[l:], methods, h)
+	if route.optional == nil {
+		route.optional = make(map[string][]segment)
+	}
+	route.optional[method] = optional
 }
 
-// Router is a router.
+// Router is a router. Routes may be registered and removed while the router
+// is serving requests; requests are served using a snapshot of the routes
+// that is recompiled on the first request after they change. Use
+// Router.Batch to make several changes visible to requests at once.
 type Router struct {
 	base *Route
 	// map[method]Handler
-	defaultHandlers map[string]Handler
-	notFoundHandler Handler
+	defaultHandlers         map[string]Handler
+	notFoundHandler         Handler
+	methodNotAllowedHandler Handler
+	autoOptions             bool
+	autoHead                bool
+	strict                  bool
+	redirect                RedirectPolicy
+	caseMode                CaseMode
+	escapedPath             bool
+	errorRenderer           ErrorRenderer
+	errorHandler            ErrorHandler
+	panicHook               PanicHook
+	constraints             map[string]Constraint
+	// Validation rules registered with Rule, replaced rather than modified
+	// when a rule is added
+	rules map[string]Rule
+	// The router whose validation rules are used for names not in rules: the
+	// router this one was last mounted in, or the one it's a host router for
+	ruleParent *Router
+	// Named routes
+	names map[string]*Route
+	// Routers for specific hosts, in order of precedence
+	hosts []*hostRoute
+
+	middleware         []Middleware
+	fallbackMiddleware Fallback
+	// The fallback handlers wrapped with the middleware (where enabled)
+	composedDefaults         map[string]Handler
+	composedNotFound         Handler
+	composedMethodNotAllowed Handler
+
+	// The snapshot used for serving requests (a *snapshot)
+	snapshot atomic.Value
+	// Whether the snapshot needs to be recompiled (accessed atomically)
+	dirty int32
+	// The number of running batches, which hold back recompiling the
+	// snapshot (see Router.Batch)
+	batches int
+	// Guards the routes and everything used to compile the snapshot
+	mtx sync.Mutex
+}
+
+// RouterOption is an option used to configure a Router.
+type RouterOption func(*Router)
+
+// WithAutoOptions sets whether the router automatically answers OPTIONS
+// requests for routes that don't have an OPTIONS handler. The automatic
+// response is a NoContent (204) with the "Allow" header set to the methods
+// registered on the route. Enabled by default.
+func WithAutoOptions(enabled bool) RouterOption {
+	return func(router *Router) {
+		router.autoOptions = enabled
+	}
 }
 
-// NewRouter creates a new router.
-func NewRouter() *Router {
-	return &Router{
+// WithAutoHead sets whether HEAD requests to routes that don't have a HEAD
+// handler are handled by the route's GET handler. The body written by the
+// handler is passed on to the response writer, which is expected to discard
+// it (as net/http's server does, while still setting the Content-Length it
+// would have for a GET request). Enabled by default.
+func WithAutoHead(enabled bool) RouterOption {
+	return func(router *Router) {
+		router.autoHead = enabled
+	}
+}
+
+// NewRouter creates a new router with the given options.
+func NewRouter(opts ...RouterOption) *Router {
+	router := &Router{
 		base: &Route{
 			methods:  make(Methods),
 			matchAny: make(map[string]Handler),
@@ -238,15 +339,59 @@ func NewRouter() *Router {
 			handlers: make(map[string]Handler),
 		},
 		defaultHandlers: make(map[string]Handler),
-		notFoundHandler: HandlerFunc(func(c *Context) {
-			c.WriteHeader(http.StatusNotFound)
-		}),
+		autoOptions:     true,
+		autoHead:        true,
+		constraints:     cloneConstraints(builtinConstraints),
+		names:           make(map[string]*Route),
+		dirty:           1,
 	}
+	router.base.router = router
+	router.notFoundHandler = HandlerFunc(router.notFound)
+	router.methodNotAllowedHandler = HandlerFunc(router.methodNotAllowed)
+	for _, opt := range opts {
+		opt(router)
+	}
+	router.composeFallbacks()
+	return router
 }
 
 // Handle handles the given pattern, allowing the given methods, and using the
 // given handler. If the pattern is an empty string (""), nothing is done and
 // nil is returned.
+//
+// A slug of the form "{name}" is a parameter which matches any single
+// non-empty slug, the value of which is stored in Context.Params under
+// "name". A parameter of the form "{name:constraint}" only matches slugs that
+// satisfy the constraint, where the constraint is either the name of a
+// constraint registered with Router.Constraint (e.g., "{id:int}") or a
+// regular expression that must match the entire slug (e.g.,
+// "{slug:[a-z0-9-]+}"). Slugs may also mix literal text and parameters
+// (e.g., "{name}.{ext}" or "v{version}"), as long as parameters are separated
+// by literal text. Each parameter in such a slug matches as little as
+// possible (at least one character), with the final parameter matching
+// whatever remains, so "{name}.{ext}" matches "a.tar.gz" with a name of "a"
+// and an ext of "tar.gz", while "{name}.{ext:[a-z]+}" matches it with a name
+// of "a.tar" and an ext of "gz". A final slug of the form "{name...}" is a
+// catch-all parameter which matches the rest of the path (zero or more
+// slugs), storing what remains of the path (without the leading slash) under
+// "name". E.g., with a pattern of "/static/{path...}", a request for
+// "/static/css/main.css" has a path of "css/main.css", and a request for
+// "/static/" has a path of "". Unlike Route.HandleAny, a catch-all parameter
+// doesn't match "/static".
+//
+// A parameter whose name is followed by "?" is optional (e.g.,
+// "/reports/{year?}"), and must be at the end of the pattern (along with any
+// other optional parameters). The handler is registered on the route for the
+// full pattern, which also matches paths with the optional parameters left
+// out (e.g., "/reports" as well as "/reports/2024"), so the route's
+// middleware, matchers, and name apply to those paths too. A route registered
+// for a shorter path itself (e.g., "/reports") takes precedence. A default
+// value, set in the Context's Params when the parameter is left out, can be
+// given after a "=" (e.g., "/list/{page?=1}" or "/list/{page?=1:int}").
+//
+// Panics if the pattern is malformed (see Router.TryHandle). Registering a
+// handler for a pattern and method that already has one replaces it, unless
+// the router is in strict mode (see WithStrict), in which case it panics.
 func (router *Router) Handle(pattern string, methods Methods, h Handler) *Route {
 	// NOTE: If adding the functionality below, make sure to move the
 	// documentation to the appropriate place.
@@ -260,22 +405,41 @@ func (router *Router) Handle(pattern string, methods Methods, h Handler) *Route
 
 	if pattern == "" {
 		return nil
-	} else if pattern == "/" {
-		for method := range methods {
-			router.base.handlers[method] = h
-		}
-		router.base.methods.CopyFrom(methods)
-		return router.base
 	}
-	if pattern[0] == '/' {
-		pattern = pattern[1:]
+	return router.getRoute(pattern, methods, h)
+}
+
+// getRoute gets the route for the non-empty pattern, creating it if
+// necessary, and sets the handler for the given methods. Panics if the
+// pattern is malformed, or if it conflicts with an existing route and the
+// router is in strict mode.
+func (router *Router) getRoute(pattern string, methods Methods, h Handler) *Route {
+	return router.getMatchRoute(pattern, methods, h, nil)
+}
+
+// getMatchRoute is like getRoute, but registers the handler with the given
+// matchers, if any.
+func (router *Router) getMatchRoute(
+	pattern string, methods Methods, h Handler, matchers []Matcher,
+) *Route {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	route, err := router.register(pattern, methods, h, matchers, router.strict)
+	if err != nil {
+		panic(err)
 	}
-	/*
-		if l1 := len(pattern) - 1; pattern[l1] == '/' {
-			pattern = pattern[:l1]
-		}
-	*/
-	return router.base.getRoute(pattern, methods, h)
+	return route
+}
+
+// insertRoute inserts the route for the parsed pattern, setting the handler
+// for the given methods, with the given matchers, if any.
+func (router *Router) insertRoute(
+	segs []segment, methods Methods, h Handler, matchers []Matcher,
+) *Route {
+	if len(segs) == 0 {
+		router.base.methods.CopyFrom(methods)
+	}
+	return router.base.insert(segs, methods, h, matchers)
 }
 
 // Get handles the given pattern with the given handler for GET requests.
@@ -303,24 +467,49 @@ func (router *Router) All(pattern string, h Handler) *Route {
 	return router.Handle(pattern, MethodsAll(), h)
 }
 
-// Default sets the default handler for the given methods.
+// Default sets the default handler for the given methods, used for requests
+// that don't match any route (and aren't handled by a HandleAny handler or a
+// default handler for a prefix, see DefaultPrefix). The handler is passed any
+// params matched before routing failed, and Context.Failure reports why it
+// failed.
 func (router *Router) Default(methods Methods, h Handler) {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
 	for method := range methods {
 		router.defaultHandlers[method] = h
 	}
+	router.composeFallbacks()
 }
 
 // NotFound sets the handler for when a request results in a NotFound. It is
 // not required for the handler to actually handle the request with a not found
 // response. The default behavior is to just write a NotFound (404) status
-// code.
+// code, or to use the router's error renderer if it has one (see
+// WithErrorRenderer). Passing nil restores the default.
 func (router *Router) NotFound(h Handler) {
 	if h == nil {
-		h = HandlerFunc(func(c *Context) {
-			c.WriteHeader(http.StatusNotFound)
-		})
+		h = HandlerFunc(router.notFound)
 	}
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
 	router.notFoundHandler = h
+	router.composeFallbacks()
+}
+
+// MethodNotAllowed sets the handler for when a request's path matches a route
+// but the route has no handler for the request's method (and no HandleAny
+// handler catches it). The "Allow" header is set on the response before the
+// handler is called. The default behavior is to just write a
+// MethodNotAllowed (405) status code, or to use the router's error renderer
+// if it has one (see WithErrorRenderer). Passing nil restores the default.
+func (router *Router) MethodNotAllowed(h Handler) {
+	if h == nil {
+		h = HandlerFunc(router.methodNotAllowed)
+	}
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	router.methodNotAllowedHandler = h
+	router.composeFallbacks()
 }
 
 // HandleFunc is the same as Handle but takes a HandlerFunc.
@@ -363,117 +552,412 @@ func (router *Router) NotFoundFunc(f HandlerFunc) {
 	router.NotFound(f)
 }
 
-func (router *Router) getDefaultHandler(method string) Handler {
-	h := router.defaultHandlers[method]
-	if h == nil {
-		return router.defaultHandlers[MethodAll]
-	}
-	return h
+// MethodNotAllowedFunc is the same as MethodNotAllowed but takes a
+// HandlerFunc.
+func (router *Router) MethodNotAllowedFunc(f HandlerFunc) {
+	router.MethodNotAllowed(f)
 }
 
 // ServeHTTP implements the ServeHTTP function for the http.Handler interface.
+//
+// Each slug of the request's path is matched against the child routes in
+// order of precedence: static routes first, then constrained parameters
+// (including slugs mixing literal text and parameters), then unconstrained
+// parameters, then catch-all parameters (parameters of the same kind are
+// tried in the order they were registered). If a branch doesn't lead to a
+// route with a handler for the request's method, the next branch is tried. If
+// no branch does, the request falls back to the HandleAny handlers of the
+// routes along the path that was matched (see Route.HandleAny), then the
+// Default handlers, then the NotFound handler.
 func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	urlPath := r.URL.Path
-	upl := len(urlPath)
-	if upl != 0 && urlPath[0] == '/' {
+	router.serve(w, r, router.requestPath(r), nil)
+}
+
+// serve routes the request using the given path rather than the request's
+// URL path. The given parent params are included in the params passed to the
+// handler, with the matched params taking precedence.
+func (router *Router) serve(
+	w http.ResponseWriter, r *http.Request,
+	urlPath string, parentParams map[string]string,
+) {
+	s := router.getSnapshot()
+	c := acquireContext(w, r)
+	c.router = router
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	if hostRouter := s.matchHost(host, &c.params); hostRouter != nil {
+		params := paramsMap(parentParams, c.params)
+		releaseContext(c)
+		hostRouter.serve(w, r, urlPath, params)
+		return
+	}
+	if router.trackResponse(c) {
+		defer router.recoverPanic(c)
+	}
+	if urlPath != "" && urlPath[0] == '/' {
 		urlPath = urlPath[1:]
-		upl--
-	}
-	trailingSlash := upl != 0 && urlPath[upl-1] == '/'
-	route, params := router.base, make(map[string]string)
-pathLoop:
-	for l := nextSlug(urlPath); urlPath != ""; l = nextSlug(urlPath) {
-		var slug string
-		if l != -1 {
-			slug = urlPath[:l]
-			urlPath = urlPath[l+1:]
-			if trailingSlash && l != 0 && urlPath == "" {
-				urlPath = "/"
+	}
+	if n := router.match(s.tree, urlPath, r, &c.params); n != nil {
+		handler := router.getHandler(n, r)
+		c.setParams(parentParams)
+		handler.ServeC(c)
+		releaseContext(c)
+		return
+	}
+	c.params = c.params[:0]
+	if p, ok := router.casePath(s, r, urlPath, &c.params); ok {
+		router.sendRedirect(w, r, p)
+		releaseContext(c)
+		return
+	}
+	if p, ok := router.redirectPath(s, r, urlPath, &c.params); ok {
+		router.sendRedirect(w, r, p)
+		releaseContext(c)
+		return
+	}
+	c.params = c.params[:0]
+	n := router.walk(s.tree, urlPath, r.Method, &c.params)
+	c.setParams(parentParams)
+	router.serveFallback(c, s, urlPath, n)
+	releaseContext(c)
+}
+
+// match finds the node matching the path that has a handler for the method,
+// backtracking out of branches that don't lead to such a node. Returns nil if
+// no node is found. The parameters matched along the way are appended to
+// params.
+func (router *Router) match(
+	n *node, path string, r *http.Request, params *[]pathParam,
+) *node {
+	if path == "" {
+		if handler := router.getHandler(n, r); handler != nil {
+			return n
+		}
+		return router.matchAbsent(n, r, params)
+	}
+	method := r.Method
+	slug, rest := nextSegment(path)
+	slug = router.unescape(slug)
+	child := n.lookup(slug)
+	if child != nil && router.hasMethod(child.methods, method) {
+		if found := router.match(child, rest, r, params); found != nil {
+			return found
+		}
+	}
+	for _, child := range n.params {
+		if !router.hasMethod(child.methods, method) {
+			continue
+		}
+		l := len(*params)
+		rest, ok := router.matchParam(child, slug, rest, path, params)
+		if !ok {
+			continue
+		}
+		if found := router.match(child, rest, r, params); found != nil {
+			return found
+		}
+		*params = (*params)[:l]
+	}
+	return nil
+}
+
+// matchAbsent finds the descendant of the node whose handler for the request
+// matches the node's path by leaving out its trailing optional parameters,
+// preferring those leaving out the fewest. Returns nil if no node is found.
+// The default values of the parameters left out are appended to params.
+func (router *Router) matchAbsent(n *node, r *http.Request, params *[]pathParam) *node {
+	for _, a := range n.absent {
+		method := r.Method
+		if a.node.getRequestHandler(r, method) == nil {
+			if method != http.MethodHead || !router.autoHead ||
+				a.node.getRequestHandler(r, http.MethodGet) == nil {
+				continue
 			}
-		} else {
-			slug = urlPath
-			urlPath = ""
+			method = http.MethodGet
 		}
-		if slug == "" {
-			slug = "/"
+		optional := a.node.getRequestOptional(r, method)
+		if len(optional) < a.depth {
+			continue
 		}
+		for _, seg := range optional[len(optional)-a.depth:] {
+			if seg.hasDefault {
+				*params = append(*params, pathParam{name: seg.name, value: seg.def})
+			}
+		}
+		return a.node
+	}
+	return nil
+}
 
-		ro := route.routes[slug]
-		if ro == nil {
-			for _, ro := range route.routes {
-				if ro.param && ro.methods.HasOrAll(r.Method) {
-					params[ro.name] = slug
-					route = ro
-					continue pathLoop
+// walk follows the path as far as it matches (without backtracking), using
+// the same precedence as match, and returns the node to fall back from.
+// Returns nil if there is no node to fall back from.
+func (router *Router) walk(
+	n *node, path, method string, params *[]pathParam,
+) *node {
+	for path != "" {
+		slug, rest := nextSegment(path)
+		slug = router.unescape(slug)
+		child := n.lookup(slug)
+		if child == nil {
+			for _, p := range n.params {
+				if !router.hasMethod(p.methods, method) {
+					continue
+				}
+				if pRest, ok := router.matchParam(p, slug, rest, path, params); ok {
+					child, rest = p, pRest
+					break
 				}
 			}
-			if slug == "/" {
-				route = route.parent
-			}
-			if route != nil {
-				if handler := route.getParentMatch(r.Method); handler != nil {
-					handler.ServeC(newContext(w, r, params))
-					return
+			if child == nil {
+				if slug == "/" {
+					return n.parent
 				}
+				return n
 			}
-			router.serveDefault(w, r)
-			return
-		}
-		route = ro
-		if !route.methods.HasOrAll(r.Method) {
-			break
-		}
-		if route.param {
-			params[route.name] = slug
+		} else if !router.hasMethod(child.methods, method) {
+			return child
 		}
+		n, path = child, rest
 	}
+	return n
+}
 
-	// True if the route doesn't have an associated handler (not an endpoint)
-	handler := route.getHandler(r.Method)
-	if handler == nil {
-		if handler := route.getParentMatch(r.Method); handler != nil {
-			handler.ServeC(newContext(w, r, params))
-			return
-		}
-		router.serveDefault(w, r)
-		return
+// getHandler gets the node's handler for the request, using the GET handler
+// for HEAD requests if there isn't a HEAD handler and the router handles them
+// automatically.
+func (router *Router) getHandler(n *node, r *http.Request) Handler {
+	handler := n.getRequestHandler(r, r.Method)
+	if handler == nil && r.Method == http.MethodHead && router.autoHead {
+		handler = n.getRequestHandler(r, http.MethodGet)
 	}
-	handler.ServeC(newContext(w, r, params))
+	return handler
 }
 
-// ServeC implements the ServeC function for the jmux Handler interface.
+// ServeC implements the ServeC function for the jmux Handler interface. The
+// request's full path is routed, with the context's params being passed on to
+// the handler (with any params matched by this router taking precedence). Use
+// Router.Mount to route only what remains of the path after a prefix.
 func (router *Router) ServeC(c *Context) {
-	// TODO: Check to make sure things work
-	WrapH(router).ServeC(c)
+	router.serve(c.Writer, c.Request, router.requestPath(c.Request), c.Params)
 }
 
-func (router *Router) serveDefault(w http.ResponseWriter, r *http.Request) {
-	handler := router.getDefaultHandler(r.Method)
+// allowed returns the methods allowed for the node, including those
+// automatically handled by the router.
+func (router *Router) allowed(n *node) Methods {
+	methods := n.allowed()
+	if router.autoHead && methods.Has(http.MethodGet) {
+		methods.Set(http.MethodHead)
+	}
+	if router.autoOptions {
+		methods.Set(http.MethodOptions)
+	}
+	return methods
+}
+
+// serveFallback handles a request that failed to match a handler on the
+// given node, which may be nil.
+func (router *Router) serveFallback(c *Context, s *snapshot, urlPath string, n *node) {
+	method := c.Request.Method
+	found := router.findAny(s.tree, urlPath)
+	if found == nil {
+		c.failure = FailureNoPath
+	} else if router.hasVariant(found, method) {
+		c.failure = FailureMatcherRejected
+	} else {
+		c.failure = FailureWrongMethod
+	}
+	if method == http.MethodOptions && router.autoOptions && found != nil {
+		c.RespHeader().Set("Allow", router.allowed(found).String())
+		c.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if n != nil {
+		if handler := n.getParentMatch(method); handler != nil {
+			handler.ServeC(c)
+			return
+		}
+		if method == http.MethodHead && router.autoHead {
+			if handler := n.getParentMatch(http.MethodGet); handler != nil {
+				handler.ServeC(c)
+				return
+			}
+		}
+	}
+	if c.failure == FailureWrongMethod {
+		c.clearParams()
+		c.RespHeader().Set("Allow", router.allowed(found).String())
+		s.methodNotAllowed.ServeC(c)
+		return
+	}
+	router.serveDefault(c, s, urlPath)
+}
+
+// serveDefault handles a request using the default handler for the most
+// specific prefix of the path, falling back to the router's default handlers,
+// then the NotFound handler. The context's params, matched before routing
+// failed, are kept, with those matched by the prefix taking precedence.
+func (router *Router) serveDefault(c *Context, s *snapshot, urlPath string) {
+	method := c.Request.Method
+	c.params = c.params[:0]
+	if n := router.findDefault(s.tree, urlPath, method, &c.params); n != nil {
+		if len(c.params) != 0 {
+			c.setParams(c.Params)
+		}
+		n.getDefaultHandler(method).ServeC(c)
+		return
+	}
+	handler := s.getDefaultHandler(method)
 	if handler == nil {
-		ToHTTP(router.notFoundHandler).ServeHTTP(w, r)
+		s.notFound.ServeC(c)
 		return
 	}
-	handler.ServeC(newContext(w, r, make(map[string]string)))
+	handler.ServeC(c)
+}
+
+// findDefault finds the node with a default handler for the method whose
+// prefix matches the most of the path, descending into the node's children
+// regardless of the methods they have handlers for. Children are tried using
+// the same precedence as match. Returns nil if no node is found. The params
+// matched along the way are appended to params.
+func (router *Router) findDefault(
+	n *node, path, method string, params *[]pathParam,
+) *node {
+	if path != "" {
+		slug, rest := nextSegment(path)
+		slug = router.unescape(slug)
+		if child := n.lookup(slug); child != nil {
+			if found := router.findDefault(child, rest, method, params); found != nil {
+				return found
+			}
+		}
+		for _, child := range n.params {
+			l := len(*params)
+			rest, ok := router.matchParam(child, slug, rest, path, params)
+			if !ok {
+				continue
+			}
+			if found := router.findDefault(child, rest, method, params); found != nil {
+				return found
+			}
+			*params = (*params)[:l]
+		}
+	}
+	if n.getDefaultHandler(method) != nil {
+		return n
+	}
+	return nil
 }
 
 func nextSlug(path string) int {
 	return strings.IndexByte(path, '/')
 }
 
+// nextSegment splits the next slug off of the path, which shouldn't have a
+// leading slash. Empty slugs (from a trailing slash or repeated slashes) are
+// returned as "/".
+func nextSegment(path string) (slug, rest string) {
+	l := nextSlug(path)
+	if l == -1 {
+		return path, ""
+	}
+	slug, rest = path[:l], path[l+1:]
+	if rest == "" && l != 0 {
+		rest = "/"
+	}
+	if slug == "" {
+		slug = "/"
+	}
+	return slug, rest
+}
+
+// pathParam is a path parameter matched while routing.
+type pathParam struct {
+	name, value string
+}
+
+// paramsMap returns a new map of the parent params and the matched params
+// (which take precedence), or nil if there are none.
+func paramsMap(parent map[string]string, params []pathParam) map[string]string {
+	if len(parent) == 0 && len(params) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(parent)+len(params))
+	for name, value := range parent {
+		m[name] = value
+	}
+	for _, p := range params {
+		m[p.name] = p.value
+	}
+	return m
+}
+
 // Context is what is passed to jmux handlers.
 type Context struct {
 	// Request is the request.
 	Request *http.Request
 	// Writer is the response writer associated with the request.
 	Writer http.ResponseWriter
-	// Params are any path parameters.
+	// Params are any path parameters. It's nil if there are none, so that
+	// requests without params don't allocate a map for them.
 	Params map[string]string
+
+	// Used for matching params while routing, and the pooled slice it came
+	// from
+	params    []pathParam
+	paramsBuf *[]pathParam
+	// Why routing failed, if it did
+	failure RoutingFailure
+	// The router routing the request, if any
+	router *Router
+	// Tracks the response when the router recovers from panics
+	rw responseWriter
 }
 
 func newContext(w http.ResponseWriter, r *http.Request, params map[string]string) *Context {
 	return &Context{Writer: w, Request: r, Params: params}
 }
 
+// paramsPool pools the slices used for matching params while routing.
+var paramsPool = sync.Pool{
+	New: func() any {
+		return new([]pathParam)
+	},
+}
+
+// acquireContext creates a context for the request, with a pooled slice for
+// matching params. Only the slice is pooled, so handlers may keep the context
+// and its Params after returning. This makes the context the one allocation
+// made for requests without params.
+func acquireContext(w http.ResponseWriter, r *http.Request) *Context {
+	buf := paramsPool.Get().(*[]pathParam)
+	return &Context{Writer: w, Request: r, params: *buf, paramsBuf: buf}
+}
+
+// releaseContext returns the context's slice for matching params to the
+// pool. The context must not be used for routing afterwards.
+func releaseContext(c *Context) {
+	if c.paramsBuf == nil {
+		return
+	}
+	*c.paramsBuf = c.params[:0]
+	paramsPool.Put(c.paramsBuf)
+	c.params, c.paramsBuf = nil, nil
+}
+
+// setParams sets Params to a new map of the parent params and the matched
+// params.
+func (c *Context) setParams(parent map[string]string) {
+	c.Params = paramsMap(parent, c.params)
+}
+
+// clearParams clears Params.
+func (c *Context) clearParams() {
+	c.Params = nil
+}
+
 // Write writes the bytes to the underlying resposne writer.
 func (c *Context) Write(p []byte) (int, error) {
 	return c.Writer.Write(p)
@@ -532,38 +1016,31 @@ func (c *Context) WriteFile(name string) {
 	http.ServeFile(c.Writer, c.Request, name)
 }
 
-// writeError writes the given error code and message to the underlying
-// response writer.
+// WriteError writes the given error code and message to the underlying
+// response writer as plain text, or using the router's error renderer if it
+// has one (see WithErrorRenderer).
 func (c *Context) WriteError(code int, msg string) {
+	if r := c.errorRenderer(); r != nil {
+		r(c, NewProblem(code, msg))
+		return
+	}
 	http.Error(c.Writer, msg, code)
 }
 
 // BadRequest write a BadRequest response with the given message.
 func (c *Context) BadRequest(msg string) {
-	if msg != "" {
-		c.WriteError(http.StatusBadRequest, msg)
-	} else {
-		c.WriteHeader(http.StatusBadRequest)
-	}
+	c.writeStatusError(http.StatusBadRequest, msg)
 }
 
 // Unauthorized write a Unauthorized response with the given message.
 func (c *Context) Unauthorized(msg string) {
-	if msg != "" {
-		c.WriteError(http.StatusUnauthorized, msg)
-	} else {
-		c.WriteHeader(http.StatusUnauthorized)
-	}
+	c.writeStatusError(http.StatusUnauthorized, msg)
 }
 
 // InternalServerError write a InternalServerError response with the given
 // message.
 func (c *Context) InternalServerError(msg string) {
-	if msg != "" {
-		c.WriteError(http.StatusInternalServerError, msg)
-	} else {
-		c.WriteHeader(http.StatusInternalServerError)
-	}
+	c.writeStatusError(http.StatusInternalServerError, msg)
 }
 
 // ReadBodyJSON reads the body into the given object (should be a pointer).
@@ -709,6 +1186,27 @@ func CloneMethods(methods Methods) Methods {
 	return m
 }
 
+// Slice returns the methods as a sorted slice. The wildcard method
+// (MethodAll) is included as an empty string if present.
+func (m Methods) Slice() []string {
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// String returns the methods as a sorted, comma-separated list (the format
+// used by the "Allow" header). The wildcard method (MethodAll) is omitted.
+func (m Methods) String() string {
+	methods := m.Slice()
+	if len(methods) != 0 && methods[0] == MethodAll {
+		methods = methods[1:]
+	}
+	return strings.Join(methods, ", ")
+}
+
 // Get adds the GET method to the methods.
 func (m Methods) Get() Methods {
 	m[http.MethodGet] = Unit{}
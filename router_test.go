@@ -1,11 +1,15 @@
 package jmux
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	urlpkg "net/url"
 	"path"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -198,3 +202,533 @@ func joinPath(base string, slugs ...string) string {
 	}
 	return url.String()
 }
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/users", func(c *Context) {
+		c.WriteString("GET /users")
+	})
+	router.PostFunc("/users", func(c *Context) {
+		c.WriteString("POST /users")
+	})
+	router.DeleteFunc("/users/{id}", func(c *Context) {
+		c.WriteString("DELETE /users/" + c.Params["id"])
+	})
+
+	rec := serveRecorder(router, http.MethodPut, "/users")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Fatalf(`expected Allow of "GET, HEAD, OPTIONS, POST", got "%s"`, allow)
+	}
+
+	rec = serveRecorder(router, http.MethodGet, "/users/123")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "DELETE, OPTIONS" {
+		t.Fatalf(`expected Allow of "DELETE, OPTIONS", got "%s"`, allow)
+	}
+
+	rec = serveRecorder(router, http.MethodGet, "/users/123/posts")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	router.MethodNotAllowedFunc(func(c *Context) {
+		c.WriteError(http.StatusMethodNotAllowed, "custom")
+	})
+	rec = serveRecorder(router, http.MethodPut, "/users")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if body := rec.Body.String(); body != "custom\n" {
+		t.Fatalf(`expected body of "custom\n", got "%s"`, body)
+	}
+
+	// HandleAny takes precedence over method not allowed.
+	router.base.HandleAnyFunc(MethodsAll(), func(c *Context) {
+		c.WriteString("ANY")
+	})
+	rec = serveRecorder(router, http.MethodPut, "/users")
+	if body := rec.Body.String(); body != "ANY" {
+		t.Fatalf(`expected body of "ANY", got "%s"`, body)
+	}
+}
+
+func TestAutoOptionsHead(t *testing.T) {
+	newRouter := func(opts ...RouterOption) *Router {
+		router := NewRouter(opts...)
+		router.GetFunc("/users/{id}", func(c *Context) {
+			c.RespHeader().Set("X-User", c.Params["id"])
+			c.WriteString("GET /users/" + c.Params["id"])
+		})
+		router.PutFunc("/users/{id}", func(c *Context) {
+			c.WriteString("PUT /users/" + c.Params["id"])
+		})
+		router.GetFunc("/custom", func(c *Context) {
+			c.WriteString("GET /custom")
+		})
+		router.HandleFunc(
+			"/custom",
+			NewMethods(http.MethodHead, http.MethodOptions),
+			func(c *Context) {
+				c.RespHeader().Set("X-Custom", c.Request.Method)
+			},
+		)
+		return router
+	}
+
+	router := newRouter()
+
+	rec := serveRecorder(router, http.MethodOptions, "/users/123")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Fatalf(`expected Allow of "GET, HEAD, OPTIONS, PUT", got "%s"`, allow)
+	}
+
+	rec = serveRecorder(router, http.MethodHead, "/users/123")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+	if user := rec.Header().Get("X-User"); user != "123" {
+		t.Fatalf(`expected X-User of "123", got "%s"`, user)
+	}
+	// The body is left for the server to discard, so it sets the same
+	// Content-Length as for GET.
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	resp, err := http.Head(srv.URL + "/users/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want := int64(len("GET /users/123")); resp.ContentLength != want {
+		t.Fatalf("expected Content-Length of %d, got %d", want, resp.ContentLength)
+	}
+	router.GetFunc("/flush", func(c *Context) {
+		if _, ok := c.Writer.(http.Flusher); !ok {
+			t.Error("expected HEAD response writer to be an http.Flusher")
+		}
+	})
+	serveRecorder(router, http.MethodHead, "/flush")
+
+	rec = serveRecorder(router, http.MethodOptions, "/users/123/posts")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	for _, method := range []string{http.MethodHead, http.MethodOptions} {
+		rec = serveRecorder(router, method, "/custom")
+		if got := rec.Header().Get("X-Custom"); got != method {
+			t.Fatalf(`%s: expected X-Custom of "%s", got "%s"`, method, method, got)
+		}
+	}
+
+	router = newRouter(WithAutoOptions(false), WithAutoHead(false))
+	rec = serveRecorder(router, http.MethodOptions, "/users/123")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, PUT" {
+		t.Fatalf(`expected Allow of "GET, PUT", got "%s"`, allow)
+	}
+	rec = serveRecorder(router, http.MethodHead, "/users/123")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/users/me", func(c *Context) {
+		c.WriteString("me")
+	})
+	router.GetFunc("/users/{id}", func(c *Context) {
+		c.WriteString("id=" + c.Params["id"])
+	})
+	router.GetFunc("/users/{name}/posts", func(c *Context) {
+		c.WriteString("name=" + c.Params["name"] + " posts")
+	})
+	router.GetFunc("/users/{id}/friends", func(c *Context) {
+		c.WriteString("id=" + c.Params["id"] + " friends")
+	})
+	router.PostFunc("/users/{user}", func(c *Context) {
+		c.WriteString("POST user=" + c.Params["user"])
+	})
+	router.GetFunc("/users/me/posts", func(c *Context) {
+		c.WriteString("me posts")
+	})
+	router.GetFunc("/files/{dir}/{file}", func(c *Context) {
+		c.WriteString("dir=" + c.Params["dir"] + " file=" + c.Params["file"])
+	})
+	router.GetFunc("/files/{name}", func(c *Context) {
+		c.WriteString("name=" + c.Params["name"])
+	})
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/users/me", "me"},
+		{http.MethodGet, "/users/123", "id=123"},
+		{http.MethodGet, "/users/123/posts", "name=123 posts"},
+		{http.MethodGet, "/users/123/friends", "id=123 friends"},
+		{http.MethodGet, "/users/me/posts", "me posts"},
+		// Backtracks out of the static "me" branch.
+		{http.MethodGet, "/users/me/friends", "id=me friends"},
+		{http.MethodPost, "/users/123", "POST user=123"},
+		{http.MethodGet, "/files/a/b", "dir=a file=b"},
+		{http.MethodGet, "/files/a", "name=a"},
+	}
+	for i := 0; i < 100; i++ {
+		for _, test := range tests {
+			rec := serveRecorder(router, test.method, test.path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf(
+					"%s %s: expected %d, got %d",
+					test.method, test.path, http.StatusOK, rec.Code,
+				)
+			}
+			if got := rec.Body.String(); got != test.want {
+				t.Fatalf(
+					`%s %s: expected "%s", got "%s"`,
+					test.method, test.path, test.want, got,
+				)
+			}
+		}
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/static/{path...}", func(c *Context) {
+		c.WriteString("path=" + c.Params["path"])
+	})
+	router.GetFunc("/static/index.html", func(c *Context) {
+		c.WriteString("index")
+	})
+	router.GetFunc("/repos/{owner}/{rest...}", func(c *Context) {
+		c.WriteString("owner=" + c.Params["owner"] + " rest=" + c.Params["rest"])
+	})
+	router.GetFunc("/repos/{owner}/settings", func(c *Context) {
+		c.WriteString("owner=" + c.Params["owner"] + " settings")
+	})
+
+	tests := []struct {
+		path, want string
+		code       int
+	}{
+		{"/static/css/main.css", "path=css/main.css", http.StatusOK},
+		{"/static/js/", "path=js/", http.StatusOK},
+		{"/static/", "path=", http.StatusOK},
+		{"/static/index.html", "index", http.StatusOK},
+		{"/static", "", http.StatusNotFound},
+		{"/repos/me/settings", "owner=me settings", http.StatusOK},
+		{"/repos/me/a/b/c", "owner=me rest=a/b/c", http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.want {
+			t.Fatalf(`%s: expected "%s", got "%s"`, test.path, test.want, got)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for catch-all before the last slug")
+			}
+		}()
+		router.GetFunc("/bad/{rest...}/more", func(c *Context) {})
+	}()
+}
+
+func TestConstraints(t *testing.T) {
+	router := NewRouter()
+	router.Constraint("even", func(value string) bool {
+		n, err := strconv.Atoi(value)
+		return err == nil && n%2 == 0
+	})
+	router.GetFunc("/items/{name}", func(c *Context) {
+		c.WriteString("name=" + c.Params["name"])
+	})
+	router.GetFunc("/items/{id:int}", func(c *Context) {
+		c.WriteString("id=" + c.Params["id"])
+	})
+	router.GetFunc("/items/{uuid:uuid}", func(c *Context) {
+		c.WriteString("uuid=" + c.Params["uuid"])
+	})
+	router.GetFunc("/slugs/{slug:[a-z0-9-]+}", func(c *Context) {
+		c.WriteString("slug=" + c.Params["slug"])
+	})
+	router.GetFunc("/evens/{n:even}", func(c *Context) {
+		c.WriteString("n=" + c.Params["n"])
+	})
+
+	uuid := "0b6b5f9e-2d8a-4a4e-9a57-3c1d2e4f5a6b"
+	tests := []struct {
+		path, want string
+		code       int
+	}{
+		{"/items/123", "id=123", http.StatusOK},
+		{"/items/" + uuid, "uuid=" + uuid, http.StatusOK},
+		{"/items/abc", "name=abc", http.StatusOK},
+		{"/slugs/hello-world-2", "slug=hello-world-2", http.StatusOK},
+		{"/slugs/Hello", "", http.StatusNotFound},
+		{"/evens/4", "n=4", http.StatusOK},
+		{"/evens/3", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.want {
+			t.Fatalf(`%s: expected "%s", got "%s"`, test.path, test.want, got)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for unknown constraint")
+			}
+		}()
+		router.GetFunc("/bad/{id:unknown}", func(c *Context) {})
+	}()
+}
+
+func TestMixedSlugs(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/files/{name}.{ext}", func(c *Context) {
+		c.WriteString("name=" + c.Params["name"] + " ext=" + c.Params["ext"])
+	})
+	router.GetFunc("/archives/{name}.{ext:[a-z]+}", func(c *Context) {
+		c.WriteString("name=" + c.Params["name"] + " ext=" + c.Params["ext"])
+	})
+	router.GetFunc("/files/{name}", func(c *Context) {
+		c.WriteString("name=" + c.Params["name"])
+	})
+	router.GetFunc("/v{version:int}/users", func(c *Context) {
+		c.WriteString("version=" + c.Params["version"])
+	})
+	router.GetFunc("/items/item-{id}", func(c *Context) {
+		c.WriteString("id=" + c.Params["id"])
+	})
+
+	tests := []struct {
+		path, want string
+		code       int
+	}{
+		{"/files/report.pdf", "name=report ext=pdf", http.StatusOK},
+		{"/files/a.tar.gz", "name=a ext=tar.gz", http.StatusOK},
+		{"/files/README", "name=README", http.StatusOK},
+		{"/files/.hidden", "name=.hidden", http.StatusOK},
+		{"/archives/a.tar.gz", "name=a.tar ext=gz", http.StatusOK},
+		{"/v2/users", "version=2", http.StatusOK},
+		{"/vX/users", "", http.StatusNotFound},
+		{"/items/item-42", "id=42", http.StatusOK},
+		{"/items/item-", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.want {
+			t.Fatalf(`%s: expected "%s", got "%s"`, test.path, test.want, got)
+		}
+	}
+
+	for _, pattern := range []string{
+		"/bad/{name}.json}", "/bad/{name}{ext}", "/bad/{name", "/bad/a{rest...}",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: expected panic", pattern)
+				}
+			}()
+			router.GetFunc(pattern, func(c *Context) {})
+		}()
+	}
+}
+
+func serveRecorder(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestOptionalParams(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/reports/{year?}", func(c *Context) {
+		year, ok := c.Params["year"]
+		c.WriteString(fmt.Sprintf("year=%s,%v", year, ok))
+	})
+	router.GetFunc("/list/{page?=1:int}/{size?=10}", func(c *Context) {
+		c.WriteString("page=" + c.Params["page"] + " size=" + c.Params["size"])
+	})
+	router.GetFunc("/reports/{year}/summary", func(c *Context) {
+		c.WriteString("summary=" + c.Params["year"])
+	})
+
+	tests := []struct {
+		path, want string
+		code       int
+	}{
+		{"/reports", "year=,false", http.StatusOK},
+		{"/reports/2024", "year=2024,true", http.StatusOK},
+		{"/reports/2024/summary", "summary=2024", http.StatusOK},
+		{"/list", "page=1 size=10", http.StatusOK},
+		{"/list/3", "page=3 size=10", http.StatusOK},
+		{"/list/3/50", "page=3 size=50", http.StatusOK},
+		{"/list/x", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.path)
+		if rec.Code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s: expected %q, got %q", test.path, test.want, body)
+		}
+	}
+
+	table := router.Routes()
+	if len(table) != 3 {
+		t.Fatalf("expected 3 routes, got:\n%s", table)
+	}
+	if !strings.HasSuffix(table[0].Handler, "TestOptionalParams.func2") {
+		t.Fatalf("expected handler name to be unwrapped, got %q", table[0].Handler)
+	}
+	patterns := []string{
+		"/list/{page?=1:int}/{size?=10}",
+		"/reports/{year?}",
+		"/reports/{year}/summary",
+	}
+	for i, pattern := range patterns {
+		if table[i].Pattern != pattern {
+			t.Fatalf("expected pattern %q, got:\n%s", pattern, table)
+		}
+	}
+	_, err := router.TryHandle("/list/{page?=1:int}", MethodsGet(), nil)
+	var re *RouteError
+	if !errors.As(err, &re) || re.Conflict != patterns[0] {
+		t.Fatalf("expected conflict with %q, got %v", patterns[0], err)
+	}
+
+	if !router.Remove("/list/{page?=1:int}/{size?=10}", MethodsGet()) {
+		t.Fatal("expected optional routes to be removed")
+	}
+	for _, path := range []string{"/list", "/list/3", "/list/3/50"} {
+		if rec := serveRecorder(router, http.MethodGet, path); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+
+	for _, pattern := range []string{
+		"/bad/{a?}/b",
+		"/bad/{a?}.{ext}",
+		"/bad/{a?x}",
+		"/bad/{a?=x:int}",
+		"/bad/{a?...}",
+	} {
+		if _, err := router.TryHandle(pattern, MethodsGet(), nil); !errors.Is(err, ErrMalformedPattern) {
+			t.Fatalf("%s: expected malformed pattern error, got %v", pattern, err)
+		}
+	}
+	if _, err := router.TryHandle("/reports", MethodsGet(), nil); !errors.Is(err, ErrDuplicateHandler) {
+		t.Fatalf("expected duplicate handler error, got %v", err)
+	}
+	if _, err := router.TryHandle("/reports", MethodsPost(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOptionalParamsRoute(t *testing.T) {
+	write := func(s string) HandlerFunc {
+		return func(c *Context) {
+			c.WriteString(s + c.Params["page"] + c.Params["year"])
+		}
+	}
+	auth := func(next Handler) Handler {
+		return HandlerFunc(func(c *Context) {
+			if c.Request.Header.Get("Authorization") == "" {
+				c.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeC(c)
+		})
+	}
+	router := NewRouter()
+	router.Get("/admin/{page?=1}", write("admin ")).Use(auth).Name("admin")
+	router.Get("/reports/{year?}", write("v1 "))
+	router.Get("/reports/{year?}", write("v2 ")).Headers("X-V", "2")
+	router.Get("/list/{page?}/{size?}", write("list")).Name("list")
+	router.Get("/list", write("own list"))
+
+	tests := []struct {
+		target  string
+		headers []string
+		want    string
+		code    int
+	}{
+		{"/admin", nil, "", http.StatusUnauthorized},
+		{"/admin/2", nil, "", http.StatusUnauthorized},
+		{"/admin", []string{"Authorization", "x"}, "admin 1", http.StatusOK},
+		{"/reports", nil, "v1 ", http.StatusOK},
+		{"/reports", []string{"X-V", "2"}, "v2 ", http.StatusOK},
+		{"/reports/2024", []string{"X-V", "2"}, "v2 2024", http.StatusOK},
+		{"/list", nil, "own list", http.StatusOK},
+		{"/list/3", nil, "list3", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		for i := 0; i < len(test.headers); i += 2 {
+			r.Header.Set(test.headers[i], test.headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Fatalf("%s %v: expected %d, got %d", test.target, test.headers, test.code, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s %v: expected %q, got %q", test.target, test.headers, test.want, body)
+		}
+	}
+
+	rec := serveRecorder(router, http.MethodPost, "/reports")
+	if allow := rec.Header().Get("Allow"); rec.Code != http.StatusMethodNotAllowed ||
+		allow != "GET, HEAD, OPTIONS" {
+		t.Fatalf("expected 405 with Allow of GET, got %d %q", rec.Code, allow)
+	}
+
+	urls := []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{"admin", nil, "/admin"},
+		{"admin", []string{"page", "2"}, "/admin/2"},
+		{"list", nil, "/list"},
+		{"list", []string{"page", "2"}, "/list/2"},
+		{"list", []string{"page", "2", "size", "10"}, "/list/2/10"},
+	}
+	for _, test := range urls {
+		got, err := router.URL(test.name, test.params...)
+		if err != nil || got != test.want {
+			t.Fatalf("%s %v: expected %q, got %q (%v)", test.name, test.params, test.want, got, err)
+		}
+	}
+	// Optional params can only be left out from the end.
+	if _, err := router.URL("list", "size", "10"); err == nil {
+		t.Fatal("expected error for missing page")
+	}
+}
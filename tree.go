@@ -0,0 +1,410 @@
+package jmux
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// node is a route compiled for matching requests. The compiled tree is
+// rebuilt from the routes whenever they change, and isn't modified once
+// built.
+type node struct {
+	segment
+	methods Methods
+	// The route's handlers and matchAny handlers wrapped with middleware
+	handlers map[string]Handler
+	matchAny map[string]Handler
+	variants []variant
+	defaults map[string]Handler
+	optional map[string][]segment
+	// The descendant nodes whose handlers may match the node's path by
+	// leaving out their trailing optional parameters, with the fewest left
+	// out first
+	absent []absentNode
+	// Static child nodes
+	static radixNode
+	// Static child nodes keyed by their lowercased slugs, if static slugs are
+	// matched without regard to case
+	fold *radixNode
+	// The static "/" child node, if any
+	slash *node
+	// Parameter child nodes, in order of precedence
+	params []*node
+	parent *node
+}
+
+// compile compiles the route and its children into a tree of nodes. If fold
+// is true, static slugs are matched without regard to case.
+func compile(route *Route, parent *node, fold bool) *node {
+	n := &node{
+		segment:  route.segment,
+		methods:  CloneMethods(route.methods),
+		handlers: route.composed,
+		matchAny: route.composedAny,
+		variants: route.composedVariants,
+		defaults: route.composedDefaults,
+		parent:   parent,
+	}
+	for slug, ro := range route.routes {
+		child := compile(ro, n, fold)
+		n.static.insert(slug, child)
+		if slug == "/" {
+			n.slash = child
+		}
+	}
+	if fold && len(route.routes) != 0 {
+		// Sort the slugs so that the same slug is used for those differing
+		// only by case each time.
+		slugs := make([]string, 0, len(route.routes))
+		for slug := range route.routes {
+			slugs = append(slugs, slug)
+		}
+		sort.Strings(slugs)
+		n.fold = &radixNode{}
+		for _, slug := range slugs {
+			lower := strings.ToLower(slug)
+			if n.fold.lookup(lower) == nil {
+				n.fold.insert(lower, n.static.lookup(slug))
+			}
+		}
+	}
+	n.params = make([]*node, len(route.params))
+	for i, ro := range route.params {
+		n.params[i] = compile(ro, n, fold)
+	}
+	if len(route.optional) != 0 {
+		n.optional = make(map[string][]segment, len(route.optional))
+		for method, optional := range route.optional {
+			n.optional[method] = optional
+		}
+	}
+	n.absent = absentNodes(n)
+	return n
+}
+
+// absentNode is a node whose handlers may match the path of one of its
+// ancestors, depth levels above it, by leaving out their trailing optional
+// parameters.
+type absentNode struct {
+	node  *node
+	depth int
+}
+
+// absentNodes returns the descendant nodes whose handlers may match the
+// node's path, ordered by depth and then by the precedence of their
+// ancestors.
+func absentNodes(n *node) []absentNode {
+	var absent []absentNode
+	for _, child := range n.params {
+		if child.maxOptional() >= 1 {
+			absent = append(absent, absentNode{node: child, depth: 1})
+		}
+		for _, a := range child.absent {
+			if a.node.maxOptional() > a.depth {
+				absent = append(absent, absentNode{node: a.node, depth: a.depth + 1})
+			}
+		}
+	}
+	sort.SliceStable(absent, func(i, j int) bool {
+		return absent[i].depth < absent[j].depth
+	})
+	return absent
+}
+
+// maxOptional returns the most trailing optional parameters any of the
+// node's handlers were registered with.
+func (n *node) maxOptional() int {
+	max := 0
+	for _, optional := range n.optional {
+		if len(optional) > max {
+			max = len(optional)
+		}
+	}
+	for i := range n.variants {
+		if len(n.variants[i].optional) > max {
+			max = len(n.variants[i].optional)
+		}
+	}
+	return max
+}
+
+// getRequestOptional returns the trailing optional parameters of the pattern
+// the node's handler for the request (see getRequestHandler) was registered
+// with.
+func (n *node) getRequestOptional(r *http.Request, method string) []segment {
+	for i := range n.variants {
+		v := &n.variants[i]
+		if v.methods.HasOrAll(method) && v.match(r) {
+			return v.optional
+		}
+	}
+	if n.handlers[method] == nil {
+		return n.optional[MethodAll]
+	}
+	return n.optional[method]
+}
+
+// lookup returns the static child node for the slug, or nil if there isn't
+// one.
+func (n *node) lookup(slug string) *node {
+	child := n.static.lookup(slug)
+	if child == nil && n.fold != nil {
+		child = n.fold.lookup(strings.ToLower(slug))
+	}
+	return child
+}
+
+// snapshot is the state of the router used to serve requests. Snapshots
+// aren't modified once compiled, so requests can be served using one while
+// routes are registered or removed.
+type snapshot struct {
+	tree *node
+	// The tree with static slugs matched without regard to case, used to
+	// find the canonical path when redirecting to it
+	foldTree *node
+	// The host routes, in order of precedence
+	hosts []*hostRoute
+	// The fallback handlers wrapped with the middleware (where enabled)
+	defaults         map[string]Handler
+	notFound         Handler
+	methodNotAllowed Handler
+	// The handler for errors returned by HandlerFuncE handlers
+	errorHandler ErrorHandler
+}
+
+// getSnapshot returns the current snapshot, compiling a new one first if the
+// routes have changed.
+func (router *Router) getSnapshot() *snapshot {
+	if atomic.LoadInt32(&router.dirty) != 0 {
+		router.mtx.Lock()
+		if atomic.LoadInt32(&router.dirty) != 0 &&
+			(router.batches == 0 || router.snapshot.Load() == nil) {
+			var foldTree *node
+			if router.caseMode == CaseRedirect {
+				foldTree = compile(router.base, nil, true)
+			}
+			router.snapshot.Store(&snapshot{
+				tree:             compile(router.base, nil, router.caseMode == CaseInsensitive),
+				foldTree:         foldTree,
+				hosts:            append([]*hostRoute(nil), router.hosts...),
+				defaults:         router.composedDefaults,
+				notFound:         router.composedNotFound,
+				methodNotAllowed: router.composedMethodNotAllowed,
+				errorHandler:     router.errorHandler,
+			})
+			atomic.StoreInt32(&router.dirty, 0)
+		}
+		router.mtx.Unlock()
+	}
+	return router.snapshot.Load().(*snapshot)
+}
+
+// markDirty marks the snapshot as needing to be recompiled. Must be called
+// with the router's lock held.
+func (router *Router) markDirty() {
+	atomic.StoreInt32(&router.dirty, 1)
+}
+
+func (n *node) getDefaultHandler(method string) Handler {
+	h := n.defaults[method]
+	if h == nil {
+		return n.defaults[MethodAll]
+	}
+	return h
+}
+
+func (s *snapshot) getDefaultHandler(method string) Handler {
+	h := s.defaults[method]
+	if h == nil {
+		return s.defaults[MethodAll]
+	}
+	return h
+}
+
+func (n *node) getHandler(method string) Handler {
+	h := n.handlers[method]
+	if h == nil {
+		return n.handlers[MethodAll]
+	}
+	return h
+}
+
+// getRequestHandler gets the node's handler for the request, using the given
+// method rather than the request's. Handlers with matchers are tried first.
+func (n *node) getRequestHandler(r *http.Request, method string) Handler {
+	for i := range n.variants {
+		v := &n.variants[i]
+		if v.methods.HasOrAll(method) && v.match(r) {
+			return v.handler
+		}
+	}
+	return n.getHandler(method)
+}
+
+// hasVariant returns whether the node has handlers with matchers for the
+// method, taking into account whether HEAD requests may be handled by GET
+// handlers.
+func (router *Router) hasVariant(n *node, method string) bool {
+	for i := range n.variants {
+		if router.hasMethod(n.variants[i].methods, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) getMatchAnyHandler(method string) Handler {
+	h, ok := n.matchAny[method]
+	if ok && h != nil {
+		return h
+	}
+	h, okAll := n.matchAny[MethodAll]
+	if okAll && h != nil {
+		return h
+	}
+	if !ok && !okAll {
+		return nil
+	}
+	return n.getHandler(method)
+}
+
+func (n *node) getParentMatch(method string) Handler {
+	if n.name != "/" {
+		if n.slash != nil {
+			h := n.slash.getMatchAnyHandler(method)
+			if h != nil {
+				return h
+			}
+		}
+	} else {
+		n = n.parent
+		if n != nil {
+			n = n.parent
+		}
+	}
+	for ; n != nil; n = n.parent {
+		if handler := n.getMatchAnyHandler(method); handler != nil {
+			return handler
+		}
+	}
+	return nil
+}
+
+// allowed returns the methods the node has handlers for.
+func (n *node) allowed() Methods {
+	methods := make(Methods, len(n.handlers))
+	for method, h := range n.handlers {
+		if h != nil {
+			methods[method] = Unit{}
+		}
+	}
+	for _, v := range n.variants {
+		methods.CopyFrom(v.methods)
+	}
+	return methods
+}
+
+// findAny finds the node matching the given path (without a leading slash)
+// that has handlers, regardless of the methods those handlers are for.
+// Returns nil if there is no such node.
+func (router *Router) findAny(n *node, fullPath string) *node {
+	if fullPath == "" {
+		if len(n.handlers) != 0 || len(n.variants) != 0 {
+			return n
+		} else if len(n.absent) != 0 {
+			return n.absent[0].node
+		}
+		return nil
+	}
+	slug, path := nextSegment(fullPath)
+	slug = router.unescape(slug)
+	if child := n.lookup(slug); child != nil {
+		if found := router.findAny(child, path); found != nil {
+			return found
+		}
+	}
+	var params []pathParam
+	for _, child := range n.params {
+		if rest, ok := router.matchParam(child, slug, path, fullPath, &params); ok {
+			if found := router.findAny(child, rest); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// radixNode is a node in a radix tree mapping slugs to the static children
+// of a node.
+type radixNode struct {
+	prefix string
+	// The node for the slug ending at this radix node, if any
+	value *node
+	// The first bytes of the children's prefixes
+	indices  string
+	children []*radixNode
+}
+
+// insert inserts the node for the slug.
+func (rn *radixNode) insert(slug string, value *node) {
+	for {
+		i := 0
+		for i < len(slug) && i < len(rn.prefix) && slug[i] == rn.prefix[i] {
+			i++
+		}
+		if i < len(rn.prefix) {
+			// Split the radix node at the end of the common prefix.
+			child := &radixNode{
+				prefix:   rn.prefix[i:],
+				value:    rn.value,
+				indices:  rn.indices,
+				children: rn.children,
+			}
+			rn.prefix, rn.value = rn.prefix[:i], nil
+			rn.indices = child.prefix[:1]
+			rn.children = []*radixNode{child}
+		}
+		slug = slug[i:]
+		if slug == "" {
+			rn.value = value
+			return
+		}
+		if idx := strings.IndexByte(rn.indices, slug[0]); idx != -1 {
+			rn = rn.children[idx]
+			continue
+		}
+		rn.indices += slug[:1]
+		rn.children = append(rn.children, &radixNode{prefix: slug, value: value})
+		return
+	}
+}
+
+// lookup returns the node for the slug, or nil if there isn't one.
+func (rn *radixNode) lookup(slug string) *node {
+	for {
+		if len(slug) < len(rn.prefix) || slug[:len(rn.prefix)] != rn.prefix {
+			return nil
+		}
+		slug = slug[len(rn.prefix):]
+		if slug == "" {
+			return rn.value
+		}
+		idx := strings.IndexByte(rn.indices, slug[0])
+		if idx == -1 {
+			return nil
+		}
+		rn = rn.children[idx]
+	}
+}
+
+// hasMethod returns whether the methods accept the given method, taking into
+// account whether HEAD requests may be handled by GET handlers.
+func (router *Router) hasMethod(methods Methods, method string) bool {
+	if methods.HasOrAll(method) {
+		return true
+	}
+	return method == http.MethodHead && router.autoHead &&
+		methods.Has(http.MethodGet)
+}
@@ -0,0 +1,135 @@
+package jmux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRadix(t *testing.T) {
+	slugs := []string{
+		"users", "user", "us", "usage", "a", "abc", "ab", "/", "x.y", "",
+	}
+	var root radixNode
+	nodes := make(map[string]*node, len(slugs))
+	for _, slug := range slugs {
+		nodes[slug] = &node{segment: segment{name: slug}}
+		root.insert(slug, nodes[slug])
+	}
+	for _, slug := range slugs {
+		if got := root.lookup(slug); got != nodes[slug] {
+			t.Fatalf(`%q: expected node, got %v`, slug, got)
+		}
+	}
+	for _, slug := range []string{"u", "use", "userss", "abcd", "b", "x"} {
+		if got := root.lookup(slug); got != nil {
+			t.Fatalf(`%q: expected nil, got node %q`, slug, got.name)
+		}
+	}
+}
+
+func TestStaticAllocs(t *testing.T) {
+	router := benchRouter()
+	w := nopResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, "/static/route/25", nil)
+	s := router.getSnapshot()
+	params := make([]pathParam, 0, 8)
+	allocs := testing.AllocsPerRun(100, func() {
+		params = params[:0]
+		router.match(s.tree, "static/route/25", r, &params)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocations matching, got %v", allocs)
+	}
+	// Serving allocates nothing but the context: handlers may keep it after
+	// returning (see TestRetainedContext), so it can't be pooled, and static
+	// hits leave Params nil.
+	allocs = testing.AllocsPerRun(100, func() {
+		router.ServeHTTP(w, r)
+	})
+	if allocs != 1 {
+		t.Fatalf("expected only the context to be allocated serving, got %v allocations", allocs)
+	}
+}
+
+func TestRetainedContext(t *testing.T) {
+	router := NewRouter()
+	var kept []*Context
+	keep := func(c *Context) {
+		kept = append(kept, c)
+	}
+	router.GetFunc("/a", keep)
+	router.GetFunc("/b/{x?=1}", keep)
+	router.GetFunc("/c/{y}", keep)
+
+	for _, path := range []string{"/a", "/b", "/c/2", "/b/3"} {
+		serveRecorder(router, http.MethodGet, path)
+	}
+	want := []string{"map[]", "map[x:1]", "map[y:2]", "map[x:3]"}
+	for i, c := range kept {
+		if got := fmt.Sprint(c.Params); got != want[i] {
+			t.Fatalf("%d: expected kept params of %s, got %s", i, want[i], got)
+		}
+	}
+	if kept[0] == kept[1] || kept[0].Request.URL.Path != "/a" {
+		t.Fatal("expected kept contexts not to be reused")
+	}
+}
+
+func BenchmarkStatic(b *testing.B) {
+	benchmarkRequest(b, benchRouter(), "/static/route/25")
+}
+
+func BenchmarkParams(b *testing.B) {
+	benchmarkRequest(b, benchRouter(), "/params/a/b/c/d/e")
+}
+
+func BenchmarkConstrainedParams(b *testing.B) {
+	benchmarkRequest(b, benchRouter(), "/constrained/123/abc")
+}
+
+func BenchmarkCatchAll(b *testing.B) {
+	benchmarkRequest(b, benchRouter(), "/files/css/themes/dark/main.css")
+}
+
+func BenchmarkNotFound(b *testing.B) {
+	benchmarkRequest(b, benchRouter(), "/missing/route")
+}
+
+func benchmarkRequest(b *testing.B, router *Router, path string) {
+	w := nopResponseWriter{}
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func benchRouter() *Router {
+	h := HandlerFunc(func(c *Context) {})
+	router := NewRouter()
+	for i := 0; i < 50; i++ {
+		router.Get(fmt.Sprintf("/static/route/%d", i), h)
+		router.Get(fmt.Sprintf("/static/other%d/route", i), h)
+	}
+	router.Get("/params/{a}/{b}/{c}/{d}/{e}", h)
+	router.Get("/params/{a}/{b}/{c}/{d}", h)
+	router.Get("/constrained/{id:int}/{name:alpha}", h)
+	router.Get("/constrained/{id}/{name}", h)
+	router.Get("/files/{path...}", h)
+	return router
+}
+
+type nopResponseWriter struct{}
+
+func (nopResponseWriter) Header() http.Header {
+	return http.Header{}
+}
+
+func (nopResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (nopResponseWriter) WriteHeader(int) {}
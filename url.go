@@ -0,0 +1,184 @@
+package jmux
+
+import (
+	"fmt"
+	urlpkg "net/url"
+	"sort"
+	"strings"
+)
+
+// Name names the route so that URLs for it can be generated using
+// Router.URL and Router.URLMap. Panics if the name is empty or already used
+// by another route.
+// Returns the calling route.
+func (route *Route) Name(name string) *Route {
+	if name == "" {
+		panic("empty route name")
+	}
+	router := route.router
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	if other, ok := router.names[name]; ok && other != route {
+		panic("duplicate route name: " + name)
+	}
+	if route.routeName != "" {
+		delete(router.names, route.routeName)
+	}
+	route.routeName = name
+	router.names[name] = route
+	return route
+}
+
+// GetName returns the route's name, or an empty string if it isn't named.
+func (route *Route) GetName() string {
+	route.router.mtx.Lock()
+	defer route.router.mtx.Unlock()
+	return route.routeName
+}
+
+// URL generates the path for the named route using the given params, which
+// are given as name/value pairs (e.g., URL("user", "id", "123")). See
+// Router.URLMap.
+func (router *Router) URL(name string, params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("odd number of params for route %q", name)
+	}
+	m := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		m[params[i]] = params[i+1]
+	}
+	return router.URLMap(name, m)
+}
+
+// URLMap generates the path for the named route using the given params. Each
+// param value is checked against its parameter's constraints and escaped.
+// Trailing optional parameters (see Router.Handle) without params are left
+// out of the path. An error is returned if there is no route with the name,
+// or if a param is missing or invalid. Params that aren't used in the route's
+// pattern are appended to the path as query values (sorted by name).
+func (router *Router) URLMap(name string, params map[string]string) (string, error) {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	route := router.names[name]
+	if route == nil {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+	var chain []*Route
+	for ro := route; ro.parent != nil; ro = ro.parent {
+		chain = append(chain, ro)
+	}
+	for optional := route.maxOptional(); optional > 0; optional-- {
+		if _, ok := params[chain[0].name]; ok {
+			break
+		}
+		chain = chain[1:]
+	}
+	used := make(map[string]bool)
+	segments := make([]string, 0, len(chain))
+	for i := len(chain) - 1; i >= 0; i-- {
+		segment, err := chain[i].buildSlug(params, used)
+		if err != nil {
+			return "", fmt.Errorf("route %q: %w", name, err)
+		}
+		segments = append(segments, segment)
+	}
+	path := "/" + strings.Join(segments, "/")
+
+	var extra []string
+	for param := range params {
+		if !used[param] {
+			extra = append(extra, param)
+		}
+	}
+	if len(extra) == 0 {
+		return path, nil
+	}
+	sort.Strings(extra)
+	query := make([]string, len(extra))
+	for i, param := range extra {
+		query[i] = urlpkg.QueryEscape(param) + "=" + urlpkg.QueryEscape(params[param])
+	}
+	return path + "?" + strings.Join(query, "&"), nil
+}
+
+// maxOptional returns the most trailing optional parameters any of the
+// route's handlers were registered with.
+func (route *Route) maxOptional() int {
+	max := 0
+	for _, optional := range route.optional {
+		if len(optional) > max {
+			max = len(optional)
+		}
+	}
+	for _, v := range route.variants {
+		if len(v.optional) > max {
+			max = len(v.optional)
+		}
+	}
+	return max
+}
+
+// buildSlug builds the (escaped) slug for the route from the params, marking
+// the params used.
+func (route *Route) buildSlug(params map[string]string, used map[string]bool) (string, error) {
+	if !route.param {
+		if route.name == "/" {
+			return "", nil
+		}
+		return urlpkg.PathEscape(route.name), nil
+	}
+	if route.parts == nil {
+		value, ok := params[route.name]
+		if !ok {
+			return "", fmt.Errorf("missing param %q", route.name)
+		}
+		used[route.name] = true
+		if route.catchAll {
+			// Only a trailing slash may leave an empty segment; empty, "."
+			// and ".." segments would otherwise be cleaned away.
+			segments := strings.Split(value, "/")
+			for i, segment := range segments {
+				if segment == "." || segment == ".." ||
+					(segment == "" && i != len(segments)-1) {
+					return "", fmt.Errorf("invalid value for param %q: %q", route.name, value)
+				}
+				segments[i] = urlpkg.PathEscape(segment)
+			}
+			return strings.Join(segments, "/"), nil
+		}
+		var matched []pathParam
+		if _, ok := route.matchSlug(value, "", value, &matched); !ok ||
+			value == "" || strings.IndexByte(value, '/') != -1 {
+			return "", fmt.Errorf("invalid value for param %q: %q", route.name, value)
+		}
+		return urlpkg.PathEscape(value), nil
+	}
+
+	var slug, escaped strings.Builder
+	for _, part := range route.parts {
+		if !part.param {
+			slug.WriteString(part.literal)
+			escaped.WriteString(urlpkg.PathEscape(part.literal))
+			continue
+		}
+		value, ok := params[part.name]
+		if !ok {
+			return "", fmt.Errorf("missing param %q", part.name)
+		}
+		used[part.name] = true
+		slug.WriteString(value)
+		escaped.WriteString(urlpkg.PathEscape(value))
+	}
+	// Make sure the slug would be matched with the same values.
+	var matched []pathParam
+	if strings.IndexByte(slug.String(), '/') != -1 ||
+		!matchParts(route.parts, slug.String(), &matched) {
+		return "", fmt.Errorf("invalid values for params in %q", route.pattern)
+	}
+	for _, p := range matched {
+		if params[p.name] != p.value {
+			return "", fmt.Errorf("invalid value for param %q: %q", p.name, params[p.name])
+		}
+	}
+	return escaped.String(), nil
+}
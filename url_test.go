@@ -0,0 +1,87 @@
+package jmux
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	h := HandlerFunc(func(c *Context) {})
+	router := NewRouter()
+	router.Get("/", h).Name("home")
+	router.Get("/users/{id:int}", h).Name("user")
+	router.Get("/users/{id:int}/", h).Name("user-slash")
+	router.Get("/files/{name}.{ext:[a-z]+}", h).Name("file")
+	router.Get("/static/{path...}", h).Name("static")
+	router.Get("/search/{term}", h).Name("search")
+
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+		err    bool
+	}{
+		{"home", nil, "/", false},
+		{"user", []string{"id", "123"}, "/users/123", false},
+		{"user-slash", []string{"id", "123"}, "/users/123/", false},
+		{"user", []string{"id", "abc"}, "", true},
+		{"user", nil, "", true},
+		{"user", []string{"id"}, "", true},
+		{"user", []string{"id", "1", "page", "2", "q", "a b"}, "/users/1?page=2&q=a+b", false},
+		{"file", []string{"name", "a.tar", "ext", "gz"}, "/files/a.tar.gz", false},
+		{"file", []string{"name", "a", "ext", "tar.gz"}, "", true},
+		{"static", []string{"path", "css/main file.css"}, "/static/css/main%20file.css", false},
+		{"static", []string{"path", ""}, "/static/", false},
+		{"static", []string{"path", "css/"}, "/static/css/", false},
+		{"static", []string{"path", "../../etc"}, "", true},
+		{"static", []string{"path", "css/./main.css"}, "", true},
+		{"static", []string{"path", "css//main.css"}, "", true},
+		{"static", []string{"path", "/main.css"}, "", true},
+		{"search", []string{"term", "a?b#c"}, "/search/a%3Fb%23c", false},
+		{"search", []string{"term", "a/b"}, "", true},
+		{"missing", nil, "", true},
+	}
+	for _, test := range tests {
+		got, err := router.URL(test.name, test.params...)
+		if test.err {
+			if err == nil {
+				t.Fatalf("%s %v: expected error, got %s", test.name, test.params, got)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("%s %v: %v", test.name, test.params, err)
+		}
+		if got != test.want {
+			t.Fatalf(`%s %v: expected "%s", got "%s"`, test.name, test.params, test.want, got)
+		}
+	}
+
+	got, err := router.URLMap("user", map[string]string{"id": "7"})
+	if err != nil {
+		t.Fatal(err)
+	} else if got != "/users/7" {
+		t.Fatalf(`expected "/users/7", got "%s"`, got)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic for duplicate route name")
+			}
+		}()
+		router.Get("/other", h).Name("user")
+	}()
+
+	// Generated URLs route back to the named route.
+	router.GetFunc("/echo/{a}/{b}", func(c *Context) {
+		c.WriteString(c.Params["a"] + "|" + c.Params["b"])
+	}).Name("echo")
+	url, err := router.URL("echo", "a", "x y", "b", "é")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serveRecorder(router, http.MethodGet, url)
+	if got := rec.Body.String(); got != "x y|é" {
+		t.Fatalf(`expected "x y|é", got "%s"`, got)
+	}
+}
@@ -0,0 +1,761 @@
+package jmux
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Rule checks a value against a validation rule used in "validate" struct
+// tags, returning an error describing why the value is invalid (e.g., "must
+// be at least 3 characters long"), or nil if it is valid. The param is what
+// follows the "=" in the tag (e.g., "3" for "min=3"), or empty if there is
+// none. Pointers are dereferenced before being passed to rules other than
+// "required", and rules aren't checked for nil pointers.
+type Rule func(v reflect.Value, param string) error
+
+// builtinRules are the named validation rules every router starts with.
+var builtinRules = map[string]Rule{
+	"required": ruleRequired,
+	"min":      ruleMin,
+	"max":      ruleMax,
+	"len":      ruleLen,
+	"oneof":    ruleOneOf,
+	"regex":    ruleRegex,
+	"email":    ruleEmail,
+}
+
+// ruleCheck checks that a builtin rule can be used with the param on values
+// of the type (with pointers dereferenced), before the rule is used.
+type ruleCheck func(t reflect.Type, param string) error
+
+// builtinRuleChecks are the checks for the builtin rules that have them.
+var builtinRuleChecks = map[string]ruleCheck{
+	"min":   checkSizeRule,
+	"max":   checkSizeRule,
+	"len":   checkSizeRule,
+	"regex": checkRegexRule,
+	"email": checkStringRule,
+}
+
+// ruleSet is the validation rules of a router followed by those of the
+// routers it gets rules from (see Router.ruleSet).
+type ruleSet []map[string]Rule
+
+// lookup returns the rule with the name, along with its check if it's a
+// builtin rule with one. Returns a nil rule if there's no rule with the name.
+func (rs ruleSet) lookup(name string) (Rule, ruleCheck) {
+	for _, rules := range rs {
+		if r, ok := rules[name]; ok {
+			return r, nil
+		}
+	}
+	return builtinRules[name], builtinRuleChecks[name]
+}
+
+// Violation is a value that failed a validation rule.
+type Violation struct {
+	// Field is the Go path of the value (e.g., "Address.City" or "Tags[0]").
+	Field string
+	// Pointer is the JSON pointer (RFC 6901) to the value, using the names in
+	// the fields' "json" tags (e.g., "/address/city" or "/tags/0").
+	Pointer string
+	// Rule is the name of the rule that failed (e.g., "min").
+	Rule string
+	// Param is the rule's param (e.g., "3" for "min=3").
+	Param string
+	// Err describes why the value is invalid.
+	Err error
+}
+
+// Error returns the error as a string.
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: %v", v.Pointer, v.Err)
+}
+
+// Unwrap returns the underlying error.
+func (v *Violation) Unwrap() error {
+	return v.Err
+}
+
+// ValidationError is returned when a value fails validation. It holds every
+// value that failed.
+type ValidationError struct {
+	Violations []*Violation
+}
+
+// Error returns the error as a string.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Error()
+	}
+	return "jmux: validate: " + strings.Join(msgs, "; ")
+}
+
+// Rule registers a named validation rule that can be used in "validate"
+// struct tags. The following rules are registered by default:
+//
+//	required    the value isn't the zero value (or empty, for slices and maps)
+//	min=n       strings have at least n characters, slices and maps at least
+//	            n items, and numbers are at least n
+//	max=n       the same as min, but at most n
+//	len=n       the same as min, but exactly n
+//	oneof=a b c the value is one of the space-separated values
+//	regex=re    strings match the regular expression; must be the last rule in
+//	            the tag, as the expression may contain commas
+//	email       strings are email addresses
+//
+// Registering a rule with the same name as an existing one (including the
+// builtin rules) replaces it. Routers mounted in the router (see Router.Mount)
+// and its host routers (see Router.Host) use its rules for names they have no
+// rules of their own for. Panics if the name is invalid.
+func (router *Router) Rule(name string, r Rule) {
+	if !constraintNameRegexp.MatchString(name) {
+		panic("invalid rule name: " + name)
+	}
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	// The map is replaced rather than modified so that Validate only needs to
+	// hold the lock while loading it, not while using it.
+	rules := cloneRules(router.rules)
+	rules[name] = r
+	router.rules = rules
+}
+
+// Validate validates the struct pointed to by v (or v itself) using the
+// "validate" tags of its fields, which are comma-separated rules (e.g.,
+// `validate:"required,min=3,max=64"`). Rules are checked in order, stopping
+// at the first that fails. If the tag starts with "omitempty", no rules are
+// checked for zero values. Nested structs, and structs in slices, arrays, and
+// maps, are validated as well, and fields of embedded structs are validated
+// as if they were fields of the outer struct.
+//
+// Returns a *ValidationError describing every value that failed. The tags are
+// checked before any rules are, and if a tag uses an unknown rule, gives a
+// rule an invalid param (e.g., "min=x"), or uses a rule on a type it doesn't
+// support (e.g., "email" on an int), an error describing the tag is returned
+// instead.
+func (router *Router) Validate(v any) error {
+	return validate(v, router.ruleSet())
+}
+
+// ruleSet returns the router's validation rules, followed by those of the
+// routers it gets rules from.
+func (router *Router) ruleSet() ruleSet {
+	var rs ruleSet
+	for r := router; r != nil; {
+		r.mtx.Lock()
+		rules, parent := r.rules, r.ruleParent
+		r.mtx.Unlock()
+		if len(rules) != 0 {
+			rs = append(rs, rules)
+		}
+		r = parent
+	}
+	return rs
+}
+
+// setRuleParent sets the router whose rules are used for names the router
+// has no rules for.
+func (router *Router) setRuleParent(parent *Router) {
+	router.mtx.Lock()
+	defer router.mtx.Unlock()
+	router.ruleParent = parent
+}
+
+// Validate validates v using the rules of the router routing the request (or
+// only the default rules if there isn't one). See Router.Validate.
+func (c *Context) Validate(v any) error {
+	if c.router == nil {
+		return validate(v, nil)
+	}
+	return c.router.Validate(v)
+}
+
+// BindAndValidate binds the request to the struct pointed to by dst (see
+// Context.Bind), then validates it if binding succeeded (see
+// Context.Validate).
+func (c *Context) BindAndValidate(dst any) error {
+	if err := c.Bind(dst); err != nil {
+		return err
+	}
+	return c.Validate(dst)
+}
+
+// WriteRequestError writes a JSON response describing an error from reading
+// the request (e.g., from Bind, ReadBodyJSON, or Validate). A
+// *ValidationError is written as an UnprocessableEntity (422), and a
+// *BindError or JSON decoding error as a BadRequest (400), both with a body
+// of the form:
+//
+//	{"errors": [{"pointer": "/name", "field": "Name", "rule": "min", "message": "..."}]}
+//
+// Any other error is written as an InternalServerError (500), without
+// details. If the router has an error renderer (see WithErrorRenderer), it is
+// used instead, with the errors in the problem's "errors" extension.
+func (c *Context) WriteRequestError(err error) {
+	var (
+		ve        *ValidationError
+		be        *BindError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	body := requestErrorBody{}
+	code := http.StatusBadRequest
+	switch {
+	case errors.As(err, &ve):
+		code = http.StatusUnprocessableEntity
+		for _, v := range ve.Violations {
+			body.Errors = append(body.Errors, requestErrorItem{
+				Pointer: v.Pointer,
+				Field:   v.Field,
+				Rule:    v.Rule,
+				Message: v.Err.Error(),
+			})
+		}
+	case errors.As(err, &be):
+		for _, fe := range be.Errors {
+			item := requestErrorItem{
+				Field:   fe.Field,
+				Source:  fe.Source,
+				Key:     fe.Key,
+				Message: fe.Err.Error(),
+			}
+			if fe.Source == "json" && fe.Key != "" {
+				item.Pointer = jsonPointer(strings.Split(fe.Key, ".")...)
+				item.Key = ""
+			}
+			body.Errors = append(body.Errors, item)
+		}
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		body.Errors = append(body.Errors, requestErrorItem{
+			Source:  "json",
+			Message: err.Error(),
+		})
+	default:
+		c.writeStatusError(http.StatusInternalServerError, "")
+		return
+	}
+	if r := c.errorRenderer(); r != nil {
+		p := NewProblem(code, "")
+		p.Extensions = map[string]any{"errors": body.Errors}
+		r(c, p)
+		return
+	}
+	c.RespHeader().Set("Content-Type", "application/json")
+	c.WriteStatusJSON(code, body)
+}
+
+// requestErrorBody is the body written by WriteRequestError.
+type requestErrorBody struct {
+	Errors []requestErrorItem `json:"errors"`
+}
+
+// requestErrorItem is a single error written by WriteRequestError.
+type requestErrorItem struct {
+	Pointer string `json:"pointer,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// validate validates v using the rules.
+func validate(v any, rules ruleSet) error {
+	if v == nil {
+		return nil
+	}
+	if err := checkTags(reflect.TypeOf(v), rules, make(map[reflect.Type]bool)); err != nil {
+		return err
+	}
+	var violations []*Violation
+	if err := validateValue(reflect.ValueOf(v), "", "", rules, &violations); err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+// validateValue validates the fields of the structs in v, with the given Go
+// path and JSON pointer, appending failures to violations. Returns an error
+// if a tag of a struct only found in an interface value is invalid.
+func validateValue(
+	v reflect.Value, field, pointer string,
+	rules ruleSet, violations *[]*Violation,
+) error {
+	dynamic := false
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		dynamic = dynamic || v.Kind() == reflect.Interface
+		v = v.Elem()
+	}
+	if dynamic {
+		if err := checkTags(v.Type(), rules, make(map[reflect.Type]bool)); err != nil {
+			return err
+		}
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return nil
+		}
+		for _, f := range validateFieldsOf(v.Type()) {
+			fv, ok := embeddedField(v, f.index)
+			if !ok {
+				continue
+			}
+			name := joinField(field, f.name)
+			ptr := pointer + jsonPointer(f.jsonName)
+			violation, err := f.check(fv, rules)
+			if err != nil {
+				return err
+			}
+			if violation != nil {
+				violation.Field, violation.Pointer = name, ptr
+				*violations = append(*violations, violation)
+				continue
+			}
+			if err := validateValue(fv, name, ptr, rules, violations); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if !hasStructs(v.Type().Elem()) {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			err := validateValue(
+				v.Index(i), fmt.Sprintf("%s[%d]", field, i),
+				pointer+jsonPointer(strconv.Itoa(i)), rules, violations,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || !hasStructs(v.Type().Elem()) {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			err := validateValue(
+				iter.Value(), fmt.Sprintf("%s[%q]", field, key),
+				pointer+jsonPointer(key), rules, violations,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkTags checks the tags of the fields of the structs that values of the
+// type may contain (other than in interface values), where visited holds the
+// types already checked.
+func checkTags(t reflect.Type, rules ruleSet, visited map[reflect.Type]bool) error {
+	for {
+		if visited[t] {
+			return nil
+		}
+		visited[t] = true
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array:
+			t = t.Elem()
+			continue
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return nil
+			}
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			if t == timeType {
+				return nil
+			}
+			fields := validateFieldsOf(t)
+			for i := range fields {
+				if err := fields[i].checkTag(rules); err != nil {
+					return err
+				}
+				if err := checkTags(fields[i].typ, rules, visited); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// validateField is a struct field with validation rules, or which may
+// contain structs with validation rules.
+type validateField struct {
+	// The index of the field for reflect.Value.FieldByIndex
+	index []int
+	// The Go name of the field
+	name string
+	// The name of the field in JSON
+	jsonName string
+	// The type of the field
+	typ       reflect.Type
+	omitEmpty bool
+	rules     []fieldRule
+}
+
+// fieldRule is a rule in a field's tag.
+type fieldRule struct {
+	name, param string
+}
+
+// checkTag checks that the rules in the field's tag exist and can be used
+// with their params on the field's type.
+func (f *validateField) checkTag(rules ruleSet) error {
+	t := f.typ
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, fr := range f.rules {
+		rule, check := rules.lookup(fr.name)
+		if rule == nil {
+			return fmt.Errorf("jmux: validate: field %s: unknown rule %q", f.name, fr.name)
+		}
+		if check == nil {
+			continue
+		}
+		if err := check(t, fr.param); err != nil {
+			return fmt.Errorf("jmux: validate: field %s: rule %s: %w", f.name, fr.name, err)
+		}
+	}
+	return nil
+}
+
+// check checks the field's rules against the value, returning the first
+// violation, if any (without its Field and Pointer set). Returns an error if
+// a rule can't be used on the type of the value held by an interface field
+// (the field's tag must already have been checked).
+func (f *validateField) check(v reflect.Value, rules ruleSet) (*Violation, error) {
+	if f.omitEmpty && isEmpty(v) {
+		return nil, nil
+	}
+	for _, fr := range f.rules {
+		rule, check := rules.lookup(fr.name)
+		rv, dynamic := v, false
+		if fr.name != "required" {
+			for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+				if rv.IsNil() {
+					return nil, nil
+				}
+				dynamic = dynamic || rv.Kind() == reflect.Interface
+				rv = rv.Elem()
+			}
+			if check != nil && dynamic {
+				if err := check(rv.Type(), fr.param); err != nil {
+					return nil, fmt.Errorf("jmux: validate: field %s: rule %s: %w", f.name, fr.name, err)
+				}
+			}
+		}
+		if err := rule(rv, fr.param); err != nil {
+			return &Violation{Rule: fr.name, Param: fr.param, Err: err}, nil
+		}
+	}
+	return nil, nil
+}
+
+// validateFieldsCache caches the fields of struct types to validate.
+var validateFieldsCache sync.Map
+
+// validateFieldsOf returns the fields of the struct type to validate.
+func validateFieldsOf(t reflect.Type) []validateField {
+	if fields, ok := validateFieldsCache.Load(t); ok {
+		return fields.([]validateField)
+	}
+	fields := validateFields(t, nil)
+	validateFieldsCache.Store(t, fields)
+	return fields
+}
+
+// validateFields returns the fields of the struct type to validate, with the
+// given index prefix.
+func validateFields(t reflect.Type, index []int) []validateField {
+	var fields []validateField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		jsonTag := sf.Tag.Get("json")
+		jsonName, _, _ := strings.Cut(jsonTag, ",")
+		tag := sf.Tag.Get("validate")
+		if sf.Anonymous && jsonName == "" && tag == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, validateFields(ft, fieldIndex)...)
+				continue
+			}
+		}
+		if !sf.IsExported() || (tag == "" && !hasStructs(sf.Type)) {
+			continue
+		}
+		if jsonName == "" || jsonName == "-" {
+			jsonName = sf.Name
+		}
+		f := validateField{
+			index: fieldIndex, name: sf.Name, jsonName: jsonName, typ: sf.Type,
+		}
+		for tag != "" {
+			var r string
+			if strings.HasPrefix(tag, "regex=") {
+				r, tag = tag, ""
+			} else {
+				r, tag, _ = strings.Cut(tag, ",")
+			}
+			if r == "omitempty" && len(f.rules) == 0 {
+				f.omitEmpty = true
+				continue
+			}
+			name, param, _ := strings.Cut(r, "=")
+			f.rules = append(f.rules, fieldRule{name: name, param: param})
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// embeddedField returns the field of v with the given index. Returns false if
+// the field is in a nil embedded struct pointer.
+func embeddedField(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// hasStructsCache caches the results of hasStructs.
+var hasStructsCache sync.Map
+
+// hasStructs returns whether values of the type may contain structs (other
+// than time.Time) to validate.
+func hasStructs(t reflect.Type) bool {
+	if has, ok := hasStructsCache.Load(t); ok {
+		return has.(bool)
+	}
+	has := typeHasStructs(t, make(map[reflect.Type]bool))
+	hasStructsCache.Store(t, has)
+	return has
+}
+
+// typeHasStructs returns whether values of the type may contain structs,
+// where visited holds the types already being checked, so that recursive
+// types (e.g., "type T []T") terminate.
+func typeHasStructs(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return typeHasStructs(t.Elem(), visited)
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && typeHasStructs(t.Elem(), visited)
+	case reflect.Interface:
+		return true
+	case reflect.Struct:
+		return t != timeType
+	}
+	return false
+}
+
+// joinField joins the Go path and field name.
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// pointerEscaper escapes JSON pointer reference tokens.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPointer returns the JSON pointer for the reference tokens.
+func jsonPointer(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(token))
+	}
+	return b.String()
+}
+
+// isEmpty returns whether the value is the zero value, or an empty slice or
+// map.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// checkSizeRule checks the param and type for the min, max, and len rules.
+func checkSizeRule(t reflect.Type, param string) error {
+	if _, err := strconv.ParseFloat(param, 64); err != nil {
+		return fmt.Errorf("invalid param %q", param)
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Interface:
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+// checkRegexRule checks the param and type for the regex rule.
+func checkRegexRule(t reflect.Type, param string) error {
+	if _, err := compileRegex(param); err != nil {
+		return fmt.Errorf("invalid param %q: %v", param, err)
+	}
+	return checkStringRule(t, param)
+}
+
+// checkStringRule checks the type for rules that only support strings.
+func checkStringRule(t reflect.Type, _ string) error {
+	if k := t.Kind(); k != reflect.String && k != reflect.Interface {
+		return fmt.Errorf("unsupported type %s", t)
+	}
+	return nil
+}
+
+func cloneRules(rules map[string]Rule) map[string]Rule {
+	m := make(map[string]Rule, len(rules))
+	for name, r := range rules {
+		m[name] = r
+	}
+	return m
+}
+
+func ruleRequired(v reflect.Value, _ string) error {
+	if isEmpty(v) {
+		return errors.New("is required")
+	}
+	return nil
+}
+
+func ruleMin(v reflect.Value, param string) error {
+	return checkSize(v, param, func(size, n float64) bool { return size >= n }, "at least")
+}
+
+func ruleMax(v reflect.Value, param string) error {
+	return checkSize(v, param, func(size, n float64) bool { return size <= n }, "at most")
+}
+
+func ruleLen(v reflect.Value, param string) error {
+	return checkSize(v, param, func(size, n float64) bool { return size == n }, "exactly")
+}
+
+// checkSize checks the size of the value (the length of strings, slices, and
+// maps, or the value of numbers) against the param using ok, returning an
+// error using the description of the comparison if it fails.
+func checkSize(
+	v reflect.Value, param string,
+	ok func(size, n float64) bool, desc string,
+) error {
+	// The param and type were checked by checkSizeRule.
+	n, _ := strconv.ParseFloat(param, 64)
+	var size float64
+	switch v.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	}
+	if ok(size, n) {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Errorf("must be %s %s characters long", desc, param)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Errorf("must have %s %s items", desc, param)
+	}
+	if desc == "exactly" {
+		return fmt.Errorf("must be %s", param)
+	}
+	return fmt.Errorf("must be %s %s", desc, param)
+}
+
+func ruleOneOf(v reflect.Value, param string) error {
+	options := strings.Fields(param)
+	value := fmt.Sprint(v.Interface())
+	for _, option := range options {
+		if value == option {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+}
+
+// regexpCache caches the regular expressions used by the regex rule.
+var regexpCache sync.Map
+
+// compileRegex compiles the regular expression, caching it.
+func compileRegex(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	re, _ := regexpCache.LoadOrStore(expr, compiled)
+	return re.(*regexp.Regexp), nil
+}
+
+func ruleRegex(v reflect.Value, param string) error {
+	// The param and type were checked by checkRegexRule.
+	re, _ := compileRegex(param)
+	if !re.MatchString(v.String()) {
+		return fmt.Errorf("must match %s", param)
+	}
+	return nil
+}
+
+func ruleEmail(v reflect.Value, _ string) error {
+	s := v.String()
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return errors.New("must be an email address")
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package jmux
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip/code" validate:"omitempty,regex=^[0-9]{5}(,[0-9]{4})?$"`
+}
+
+type validateBase struct {
+	ID int `json:"id" validate:"min=1"`
+}
+
+type validateUser struct {
+	validateBase
+	Name    string            `json:"name" validate:"required,min=3,max=8"`
+	Email   string            `json:"email" validate:"omitempty,email"`
+	Age     *int              `json:"age" validate:"omitempty,min=18,max=130"`
+	Role    string            `json:"role" validate:"oneof=admin user"`
+	Tags    []string          `json:"tags" validate:"max=2"`
+	Code    string            `json:"code" validate:"len=4"`
+	Slug    string            `json:"slug" validate:"lower"`
+	Address *validateAddress  `json:"address"`
+	Others  []validateAddress `json:"others"`
+}
+
+func TestValidate(t *testing.T) {
+	router := NewRouter()
+	router.Rule("lower", func(v reflect.Value, _ string) error {
+		if v.String() != strings.ToLower(v.String()) {
+			return errors.New("must be lowercase")
+		}
+		return nil
+	})
+
+	age := 12
+	user := validateUser{
+		validateBase: validateBase{ID: 0},
+		Name:         "jo",
+		Email:        "Jo <jo@example.com>",
+		Age:          &age,
+		Role:         "root",
+		Tags:         []string{"a", "b", "c"},
+		Code:         "12345",
+		Slug:         "Jo",
+		Address:      &validateAddress{Zip: "1234"},
+		Others:       []validateAddress{{City: "x", Zip: "12345,6789"}, {}},
+	}
+	err := router.Validate(&user)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	tests := []struct {
+		field, pointer, rule, msg string
+	}{
+		{"ID", "/id", "min", "must be at least 1"},
+		{"Name", "/name", "min", "must be at least 3 characters long"},
+		{"Email", "/email", "email", "must be an email address"},
+		{"Age", "/age", "min", "must be at least 18"},
+		{"Role", "/role", "oneof", "must be one of admin, user"},
+		{"Tags", "/tags", "max", "must have at most 2 items"},
+		{"Code", "/code", "len", "must be exactly 4 characters long"},
+		{"Slug", "/slug", "lower", "must be lowercase"},
+		{"Address.City", "/address/city", "required", "is required"},
+		{"Address.Zip", "/address/zip~1code", "regex", "must match ^[0-9]{5}(,[0-9]{4})?$"},
+		{"Others[1].City", "/others/1/city", "required", "is required"},
+	}
+	if len(ve.Violations) != len(tests) {
+		t.Fatalf("expected %d violations, got %v", len(tests), err)
+	}
+	for i, test := range tests {
+		v := ve.Violations[i]
+		if v.Field != test.field || v.Pointer != test.pointer || v.Rule != test.rule || v.Err.Error() != test.msg {
+			t.Fatalf("%d: expected %+v, got %+v (%v)", i, test, v, v.Err)
+		}
+	}
+
+	age = 30
+	user = validateUser{
+		validateBase: validateBase{ID: 1},
+		Name:         "jo jo",
+		Email:        "jo@example.com",
+		Age:          &age,
+		Role:         "admin",
+		Code:         "1234",
+		Address:      &validateAddress{City: "x"},
+	}
+	if err := router.Validate(user); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Invalid tags are errors rather than violations, even for values that
+	// no rules would be checked on.
+	type badParam struct {
+		N *int `validate:"min=x"`
+	}
+	type badType struct {
+		N int `validate:"email"`
+	}
+	type dynamic struct {
+		V any `validate:"email"`
+	}
+	invalid := []any{
+		&validateUser{},
+		badParam{},
+		badType{},
+		[]*badType{},
+		dynamic{V: 1},
+		&dynamic{V: []any{badType{}}},
+	}
+	for _, v := range invalid {
+		err := NewRouter().Validate(v)
+		if err == nil || errors.As(err, &ve) {
+			t.Fatalf("%T: expected tag error, got %v", v, err)
+		}
+	}
+	if err := NewRouter().Validate(dynamic{V: "jo@example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nested fields are found by concurrent first callers, and recursive
+	// types without structs terminate.
+	type nested struct {
+		Addresses map[string][]*validateAddress
+		Loop      validateLoop
+	}
+	v := nested{Addresses: map[string][]*validateAddress{"home": {{}}}}
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = router.Validate(&v)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if !errors.As(err, &ve) || len(ve.Violations) != 1 ||
+			ve.Violations[0].Field != `Addresses["home"][0].City` {
+			t.Fatalf("expected nested violation, got %v", err)
+		}
+	}
+}
+
+type validateLoop []validateLoop
+
+func TestValidateMount(t *testing.T) {
+	type slug struct {
+		Slug string `validate:"lower"`
+	}
+	router := NewRouter()
+	sub := NewRouter()
+	host := router.Host("api.example.com")
+	router.Rule("lower", func(v reflect.Value, _ string) error {
+		if v.String() != strings.ToLower(v.String()) {
+			return errors.New("must be lowercase")
+		}
+		return nil
+	})
+	h := func(c *Context) {
+		if err := c.Validate(slug{Slug: c.Params["slug"]}); err != nil {
+			c.WriteString(err.Error())
+			return
+		}
+		c.WriteString("ok")
+	}
+	sub.GetFunc("/{slug}", h)
+	host.GetFunc("/{slug}", h)
+	router.Mount("/sub", sub)
+
+	tests := []struct {
+		target, want string
+	}{
+		{"/sub/jo", "ok"},
+		{"/sub/Jo", "jmux: validate: /Slug: must be lowercase"},
+		{"http://api.example.com/jo", "ok"},
+		{"http://api.example.com/Jo", "jmux: validate: /Slug: must be lowercase"},
+	}
+	for _, test := range tests {
+		rec := serveRecorder(router, http.MethodGet, test.target)
+		if body := rec.Body.String(); body != test.want {
+			t.Fatalf("%s: expected %q, got %q", test.target, test.want, body)
+		}
+	}
+
+	// The sub-router's own rules take precedence.
+	sub.Rule("lower", func(v reflect.Value, _ string) error { return nil })
+	if body := serveRecorder(router, http.MethodGet, "/sub/Jo").Body.String(); body != "ok" {
+		t.Fatalf("expected sub-router rule to be used, got %q", body)
+	}
+}
+
+func TestWriteRequestError(t *testing.T) {
+	type request struct {
+		ID   int    `path:"id"`
+		Page int    `query:"page"`
+		Name string `json:"name" validate:"required"`
+	}
+	router := NewRouter()
+	router.PostFunc("/users/{id}", func(c *Context) {
+		var req request
+		if err := c.BindAndValidate(&req); err != nil {
+			c.WriteRequestError(err)
+			return
+		}
+		c.WriteString(req.Name)
+	})
+
+	tests := []struct {
+		target, body string
+		code         int
+		want         string
+	}{
+		{"/users/1", `{"name":"jo"}`, http.StatusOK, "jo"},
+		{"/users/1", `{}`, http.StatusUnprocessableEntity,
+			`{"errors":[{"pointer":"/name","field":"Name","rule":"required","message":"is required"}]}`},
+		{"/users/1?page=x", `{"name":1}`, http.StatusBadRequest,
+			`{"errors":[{"pointer":"/name","source":"json","message":"cannot use number as string"},` +
+				`{"field":"Page","source":"query","key":"page","message":"expected integer"}]}`},
+		{"/users/1", `{`, http.StatusBadRequest,
+			`{"errors":[{"source":"json","message":"unexpected EOF"}]}`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Fatalf("%s %s: expected %d, got %d", test.target, test.body, test.code, rec.Code)
+		}
+		if body := strings.TrimSpace(rec.Body.String()); body != test.want {
+			t.Fatalf("%s %s: expected %s, got %s", test.target, test.body, test.want, body)
+		}
+	}
+
+	c := newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	c.WriteRequestError(&json.SyntaxError{})
+	if rec := c.Writer.(*httptest.ResponseRecorder); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	c = newContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	c.WriteRequestError(errors.New("other"))
+	if rec := c.Writer.(*httptest.ResponseRecorder); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,250 @@
+package jmux
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo describes a handler registered on a route.
+type RouteInfo struct {
+	// Pattern is the full pattern of the route (e.g., "/users/{id:int}"), as
+	// the handler was registered, including any trailing optional parameters
+	// (e.g., "/list/{page?=1:int}").
+	Pattern string
+	// Methods are the methods the handler is registered for, sorted. The
+	// wildcard method (MethodAll) is included as an empty string.
+	Methods []string
+	// MatchAny is whether the handler is a catch-all handler (set with
+	// Route.HandleAny or Route.MatchAny) rather than the route's handler.
+	MatchAny bool
+	// Params are the names of the parameters in the pattern, in order.
+	Params []string
+	// Name is the route's name (see Route.Name).
+	Name string
+	// Handler is the name of the handler (the function name for
+	// HandlerFuncs, otherwise the handler's type).
+	Handler string
+}
+
+// RouteTable is a table of routes.
+type RouteTable []RouteInfo
+
+// String formats the table with one line per handler, aligning the columns.
+// Catch-all handlers are marked with a "*" after their pattern and the
+// wildcard method is shown as "*".
+func (table RouteTable) String() string {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHODS\tPATTERN\tNAME\tHANDLER")
+	for _, info := range table {
+		methods := make([]string, len(info.Methods))
+		for i, method := range info.Methods {
+			if method == MethodAll {
+				method = "*"
+			}
+			methods[i] = method
+		}
+		pattern := info.Pattern
+		if info.MatchAny {
+			pattern += " *"
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\n",
+			strings.Join(methods, ","), pattern, info.Name, info.Handler,
+		)
+	}
+	tw.Flush()
+	return sb.String()
+}
+
+// Walk calls fn for each handler registered in the router, visiting parents
+// before their children, static children in sorted order, and parameter
+// children in order of precedence. Handlers registered on the same route
+// are reported together if they're the same handler registered with the same
+// pattern. Walking stops if fn
+// returns an error, which is returned. The handlers are collected before fn
+// is called, so fn may modify the router.
+func (router *Router) Walk(fn func(RouteInfo) error) error {
+	var infos []RouteInfo
+	router.mtx.Lock()
+	router.base.walk(nil, func(info RouteInfo) error {
+		infos = append(infos, info)
+		return nil
+	})
+	router.mtx.Unlock()
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Routes returns a table of all of the handlers registered in the router,
+// sorted by pattern, then by whether they're catch-all handlers, then by
+// methods.
+func (router *Router) Routes() RouteTable {
+	var table RouteTable
+	router.Walk(func(info RouteInfo) error {
+		table = append(table, info)
+		return nil
+	})
+	sort.SliceStable(table, func(i, j int) bool {
+		a, b := table[i], table[j]
+		if a.Pattern != b.Pattern {
+			return a.Pattern < b.Pattern
+		} else if a.MatchAny != b.MatchAny {
+			return !a.MatchAny
+		}
+		return strings.Join(a.Methods, ",") < strings.Join(b.Methods, ",")
+	})
+	return table
+}
+
+func (route *Route) walk(params []string, fn func(RouteInfo) error) error {
+	// The catch-all routes used to mount routers are reported as the mount's
+	// prefix route.
+	if route.param && route.name == mountParam {
+		return nil
+	}
+	if route.param {
+		if route.parts == nil {
+			params = append(params, route.name)
+		} else {
+			for _, part := range route.parts {
+				if part.param {
+					params = append(params, part.name)
+				}
+			}
+		}
+	}
+	// The handlers are grouped by name and pattern (which differ for handlers
+	// registered with trailing optional parameters).
+	type group struct {
+		name, pattern string
+	}
+	for _, matchAny := range []bool{false, true} {
+		handlers := route.handlers
+		if matchAny {
+			handlers = route.matchAny
+		}
+		// Group the methods by handler, keeping the groups in sorted order.
+		var groups []group
+		methods := make(map[group][]string)
+		for method, h := range handlers {
+			if h == nil && !matchAny {
+				continue
+			}
+			g := group{name: handlerName(h), pattern: route.fullPattern(nil)}
+			if !matchAny {
+				g.pattern = route.fullPattern(route.optional[method])
+			}
+			if _, ok := methods[g]; !ok {
+				groups = append(groups, g)
+			}
+			methods[g] = append(methods[g], method)
+		}
+		for _, ms := range methods {
+			sort.Strings(ms)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			return methods[groups[i]][0] < methods[groups[j]][0]
+		})
+		for _, g := range groups {
+			err := fn(RouteInfo{
+				Pattern:  g.pattern,
+				Methods:  methods[g],
+				MatchAny: matchAny,
+				Params:   append([]string(nil), params...),
+				Name:     route.routeName,
+				Handler:  g.name,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Handlers with matchers are reported separately, in the order they're
+	// tried.
+	for _, v := range route.variants {
+		err := fn(RouteInfo{
+			Pattern: route.fullPattern(v.optional),
+			Methods: v.methods.Slice(),
+			Params:  append([]string(nil), params...),
+			Name:    route.routeName,
+			Handler: handlerName(v.handler),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	slugs := make([]string, 0, len(route.routes))
+	for slug := range route.routes {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		if err := route.routes[slug].walk(params, fn); err != nil {
+			return err
+		}
+	}
+	for _, ro := range route.params {
+		if err := ro.walk(params, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fullPattern returns the full pattern of the route, where optional are the
+// trailing optional parameters a handler was registered with, which end the
+// pattern.
+func (route *Route) fullPattern(optional []segment) string {
+	var slugs []string
+	for ro := route; ro.parent != nil; ro = ro.parent {
+		if ro.pattern == "/" {
+			slugs = append(slugs, "")
+		} else {
+			slugs = append(slugs, ro.pattern)
+		}
+	}
+	for i, j := 0, len(slugs)-1; i < j; i, j = i+1, j-1 {
+		slugs[i], slugs[j] = slugs[j], slugs[i]
+	}
+	for i, seg := range optional {
+		slugs[len(slugs)-len(optional)+i] = seg.optionalPattern()
+	}
+	return "/" + strings.Join(slugs, "/")
+}
+
+// optionalPattern returns the slug of the optional parameter as it appears in
+// the registered pattern (e.g., "{page?=1:int}").
+func (seg *segment) optionalPattern() string {
+	marker := "?"
+	if seg.hasDefault {
+		marker += "=" + seg.def
+	}
+	return seg.pattern[:len(seg.name)+1] + marker + seg.pattern[len(seg.name)+1:]
+}
+
+// handlerName returns the name of the handler. A nil handler (used by
+// catch-all routes to mean the route's handler) has an empty name.
+func handlerName(h Handler) string {
+	switch h := h.(type) {
+	case nil:
+		return ""
+	case groupHandler:
+		return handlerName(h.handler)
+	case HandlerFunc:
+		return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	case HandlerFuncE:
+		return runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	}
+	return fmt.Sprintf("%T", h)
+}
@@ -0,0 +1,64 @@
+package jmux
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func getUser(c *Context)    {}
+func updateUser(c *Context) {}
+
+type staticHandler struct{}
+
+func (staticHandler) ServeC(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	router := NewRouter()
+	router.GetFunc("/users/{id:int}", getUser).Name("user")
+	router.HandleFunc("/users/{id:int}", NewMethods("PATCH", "PUT"), updateUser)
+	router.Get("/static/{path...}", staticHandler{})
+	router.GetFunc("/", getUser).MatchAny(MethodsGet())
+	router.Group("/files", func(g *Group) {
+		g.Use(func(h Handler) Handler { return h })
+		g.GetFunc("/{name}.{ext}", getUser)
+	})
+
+	const pkg = "github.com/johnietre/go-jmux."
+	want := RouteTable{
+		{"/", []string{"GET"}, false, nil, "", pkg + "getUser"},
+		{"/", []string{"GET"}, true, nil, "", ""},
+		{"/files/{name}.{ext}", []string{"GET"}, false, []string{"name", "ext"}, "", pkg + "getUser"},
+		{"/static/{path...}", []string{"GET"}, false, []string{"path"}, "", "jmux.staticHandler"},
+		{"/users/{id:int}", []string{"GET"}, false, []string{"id"}, "user", pkg + "getUser"},
+		{"/users/{id:int}", []string{"PATCH", "PUT"}, false, []string{"id"}, "user", pkg + "updateUser"},
+	}
+	got := router.Routes()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	wantStr := "" +
+		"METHODS    PATTERN              NAME  HANDLER\n" +
+		"GET        /                          " + pkg + "getUser\n" +
+		"GET        / *                        \n" +
+		"GET        /files/{name}.{ext}        " + pkg + "getUser\n" +
+		"GET        /static/{path...}          jmux.staticHandler\n" +
+		"GET        /users/{id:int}      user  " + pkg + "getUser\n" +
+		"PATCH,PUT  /users/{id:int}      user  " + pkg + "updateUser\n"
+	if got := got.String(); got != wantStr {
+		t.Fatalf("expected:\n%s\ngot:\n%s", wantStr, got)
+	}
+
+	errStop := errors.New("stop")
+	n := 0
+	err := router.Walk(func(info RouteInfo) error {
+		if n++; n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || n != 2 {
+		t.Fatalf("expected walk to stop with error after 2 calls, got %v after %d", err, n)
+	}
+}